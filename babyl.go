@@ -0,0 +1,303 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/mail"
+	"strings"
+)
+
+// ErrInvalidBabylFormat is the error reported by a BabylScanner if the file
+// does not start with the BABYL OPTIONS: section or a message cannot be parsed.
+var ErrInvalidBabylFormat = errors.New("invalid Babyl format")
+
+// babylAttributes are the attributes Emacs RMAIL records for every message,
+// as opposed to labels defined by the user.
+var babylAttributes = map[string]bool{
+	"unseen":    true,
+	"deleted":   true,
+	"answered":  true,
+	"forwarded": true,
+	"filed":     true,
+	"edited":    true,
+	"resent":    true,
+	"retried":   true,
+}
+
+// BabylScanner reads the messages of a Babyl file, the format of Emacs RMAIL.
+// It provides the same interface as Scanner: Next steps through the messages,
+// which are then accessed by calling Message, Envelope and Position, while the
+// attributes and labels of the current message are returned by Attributes and
+// Labels.
+//
+// A Babyl file starts with a BABYL OPTIONS: section, available through
+// Options. Each message follows a "\x1f\x0c" separator and its attribute line.
+// If RMAIL has reformatted a message, the file holds the original header as
+// well as the header shown to the user, separated by a "*** EOOH ***" line.
+type BabylScanner struct {
+	r       *bufio.Reader
+	read    int64
+	started bool
+	options mail.Header
+	m       *mail.Message
+	visible mail.Header
+	attrs   []string
+	labels  []string
+	pos     Position
+	err     error
+}
+
+// NewBabylScanner returns a new *BabylScanner to read a Babyl file provided by
+// r.
+func NewBabylScanner(r io.Reader) *BabylScanner {
+	return &BabylScanner{r: bufio.NewReader(r)}
+}
+
+// readRecord reads up to and including the next '\x1f', which ends the options
+// section and every message. The '\x1f' is not returned.
+func (b *BabylScanner) readRecord() ([]byte, error) {
+	record, err := b.r.ReadBytes('\x1f')
+	b.read += int64(len(record))
+	if err == nil {
+		record = record[:len(record)-1]
+	}
+	return record, err
+}
+
+// start reads the options section.
+func (b *BabylScanner) start() error {
+	b.started = true
+	record, err := b.readRecord()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	line, rest := record, []byte{}
+	if e := bytes.IndexByte(record, '\n'); e != -1 {
+		line, rest = record[:e], record[e+1:]
+	}
+	if !bytes.HasPrefix(line, []byte("BABYL OPTIONS:")) {
+		return ErrInvalidBabylFormat
+	}
+	// the options section is formatted like a header, without an empty line
+	// ending it
+	rest = append(bytes.TrimRight(rest, "\r\n"), "\n\n"...)
+	m, err := mail.ReadMessage(bytes.NewReader(rest))
+	if err != nil {
+		return ErrInvalidBabylFormat
+	}
+	b.options = m.Header
+	return nil
+}
+
+// skipSpace consumes line endings and other white space up to the next
+// message, and reports whether the end of the file has been reached.
+func (b *BabylScanner) skipSpace() (bool, error) {
+	for {
+		c, err := b.r.ReadByte()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if c != '\n' && c != '\r' && c != ' ' && c != '\t' {
+			return false, b.r.UnreadByte()
+		}
+		b.read++
+	}
+}
+
+// parseAttributes parses the attribute line of a message, like
+//
+//	1, answered, unseen,, work, urgent,
+//
+// and returns whether the message has been reformatted, its attributes and
+// its labels.
+func parseAttributes(line string) (reformatted bool, attrs, labels []string) {
+	line = strings.TrimSpace(line)
+	reformatted = strings.HasPrefix(line, "1")
+	split := func(s string) []string {
+		var l []string
+		for _, f := range strings.Split(s, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				l = append(l, f)
+			}
+		}
+		return l
+	}
+	basic, user := line, ""
+	if i := strings.Index(line, ",,"); i != -1 {
+		basic, user = line[:i], line[i+2:]
+	}
+	if i := strings.IndexByte(basic, ','); i != -1 {
+		basic = basic[i+1:]
+	} else {
+		basic = ""
+	}
+	for _, a := range split(basic) {
+		if babylAttributes[a] {
+			attrs = append(attrs, a)
+		} else {
+			labels = append(labels, a)
+		}
+	}
+	return reformatted, attrs, append(labels, split(user)...)
+}
+
+// eooh returns the position of the "*** EOOH ***" line in data and the position
+// of the following line, or -1 if there is none.
+func eooh(data []byte) (start, next int) {
+	for pos := 0; pos < len(data); {
+		line, n := nextLine(data, pos)
+		if string(line) == "*** EOOH ***" {
+			return pos, n
+		}
+		if n == -1 {
+			break
+		}
+		pos = n
+	}
+	return -1, -1
+}
+
+// Next steps to the next message and returns true. It returns false if there
+// are no messages left or an error occurs. You can call the Err method to check
+// if an error occured.
+func (b *BabylScanner) Next() bool {
+	b.m, b.visible, b.attrs, b.labels = nil, nil, nil, nil
+	if b.err != nil {
+		return false
+	}
+	if !b.started {
+		if b.err = b.start(); b.err != nil {
+			return false
+		}
+	}
+	end, err := b.skipSpace()
+	if err != nil {
+		b.err = err
+		return false
+	}
+	if end {
+		return false
+	}
+
+	start := b.read
+	record, err := b.readRecord()
+	if err != nil && err != io.EOF {
+		b.err = err
+		return false
+	}
+	if !bytes.HasPrefix(record, []byte("\x0c")) {
+		b.err = ErrInvalidBabylFormat
+		return false
+	}
+	b.pos = Position{Start: start, End: b.read}
+
+	line, next := nextLine(record, 1)
+	if len(line) == 0 && next != -1 {
+		// the separator line holds nothing but the form feed
+		line, next = nextLine(record, next)
+	}
+	if next == -1 {
+		b.err = ErrInvalidBabylFormat
+		return false
+	}
+	var reformatted bool
+	reformatted, b.attrs, b.labels = parseAttributes(string(line))
+	record = record[next:]
+
+	// the message shown to the user follows the EOOH line, preceded by the
+	// original header if the message has been reformatted
+	visible, original := record, []byte(nil)
+	if s, n := eooh(record); s != -1 {
+		visible = record[n:]
+		if reformatted {
+			original = record[:s]
+		}
+	}
+	if b.m, b.err = mail.ReadMessage(bytes.NewReader(visible)); b.err != nil {
+		b.m = nil
+		return false
+	}
+	b.visible = b.m.Header
+	if original != nil {
+		// the original header replaces the one shown to the user
+		header := append(append([]byte{}, bytes.TrimRight(original, "\r\n")...), "\n\n"...)
+		h, err := mail.ReadMessage(bytes.NewReader(header))
+		if err != nil {
+			b.err = err
+			b.m = nil
+			return false
+		}
+		b.m.Header = h.Header
+	}
+	return true
+}
+
+// Err returns the first error that occured while calling Next.
+func (b *BabylScanner) Err() error {
+	return b.err
+}
+
+// Message returns the current message with its original header. Its body is
+// read from memory. Message returns nil if Next has not returned true.
+func (b *BabylScanner) Message() *mail.Message {
+	if b.err != nil {
+		return nil
+	}
+	return b.m
+}
+
+// VisibleHeader returns the header of the current message as shown by RMAIL,
+// which is the original header unless the message has been reformatted. It
+// returns nil if Message returns nil.
+func (b *BabylScanner) VisibleHeader() mail.Header {
+	if b.err != nil || b.m == nil {
+		return nil
+	}
+	return b.visible
+}
+
+// Envelope returns the From_ line recorded in the Mail-From header field of the
+// current message by RMAIL, or nil if there is none.
+func (b *BabylScanner) Envelope() *Envelope {
+	if b.err != nil || b.m == nil {
+		return nil
+	}
+	line := b.m.Header.Get("Mail-From")
+	if line == "" {
+		return nil
+	}
+	env, _ := ParseEnvelope(line)
+	return env
+}
+
+// Attributes returns the attributes RMAIL records for the current message,
+// like "unseen", "deleted" or "answered".
+func (b *BabylScanner) Attributes() []string {
+	return b.attrs
+}
+
+// Labels returns the labels the user has given the current message.
+func (b *BabylScanner) Labels() []string {
+	return b.labels
+}
+
+// Position returns the location of the current message within the Babyl file,
+// from its form feed up to and including the '\x1f' ending it. It returns the
+// zero Position if Message returns nil.
+func (b *BabylScanner) Position() Position {
+	if b.err != nil || b.m == nil {
+		return Position{}
+	}
+	return b.pos
+}
+
+// Options returns the fields of the BABYL OPTIONS: section, like Version and
+// Labels. It returns nil until Next has been called.
+func (b *BabylScanner) Options() mail.Header {
+	return b.options
+}
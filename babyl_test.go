@@ -0,0 +1,88 @@
+package mbox
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const babylWithTwoMessages = "BABYL OPTIONS: -*- rmail -*-\n" +
+	"Version: 5\n" +
+	"Labels: work,urgent\n" +
+	"Note:   This is the header of an rmail file.\n" +
+	"\x1f\x0c\n" +
+	"1, answered,, work, urgent,\n" +
+	"Mail-From: From herp.derp@example.com  Thu Jan  1 00:00:01 2015\n" +
+	"Received: by example.com\n" +
+	"From: herp.derp@example.com\n" +
+	"Subject: Reformatted\n" +
+	"*** EOOH ***\n" +
+	"From: herp.derp@example.com\n" +
+	"Subject: Reformatted\n" +
+	"\n" +
+	"First body.\n" +
+	"\x1f\x0c\n" +
+	"0, unseen,,\n" +
+	"*** EOOH ***\n" +
+	"From: bernd.lauert@example.com\n" +
+	"Subject: Unseen\n" +
+	"\n" +
+	"Second body.\n" +
+	"\x1f"
+
+func TestBabylScanner(t *testing.T) {
+	b := NewBabylScanner(strings.NewReader(babylWithTwoMessages))
+	type message struct {
+		subject, received, visibleReceived, body, attrs, labels, envelope string
+	}
+	var got []message
+	for b.Next() {
+		msg := b.Message()
+		body, err := ioutil.ReadAll(msg.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := ""
+		if b.Envelope() != nil {
+			env = b.Envelope().Sender
+		}
+		got = append(got, message{
+			subject:         msg.Header.Get("Subject"),
+			received:        msg.Header.Get("Received"),
+			visibleReceived: b.VisibleHeader().Get("Received"),
+			body:            string(body),
+			attrs:           strings.Join(b.Attributes(), ","),
+			labels:          strings.Join(b.Labels(), ","),
+			envelope:        env,
+		})
+	}
+	if b.Err() != nil {
+		t.Fatal(b.Err())
+	}
+	if v := b.Options().Get("Version"); v != "5" {
+		t.Errorf("Expected version 5, got %q", v)
+	}
+
+	expected := []message{
+		{"Reformatted", "by example.com", "", "First body.\n", "answered", "work,urgent", "herp.derp@example.com"},
+		{"Unseen", "", "", "Second body.\n", "unseen", "", ""},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d messages, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected message %d to be %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestBabylScannerInvalid(t *testing.T) {
+	b := NewBabylScanner(strings.NewReader(mboxWithOneMessage))
+	if b.Next() {
+		t.Error("Expected no message")
+	}
+	if b.Err() != ErrInvalidBabylFormat {
+		t.Errorf("Expected %v, got %v", ErrInvalidBabylFormat, b.Err())
+	}
+}
@@ -0,0 +1,250 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/mail"
+)
+
+// body streams the body of the current message of a Scanner. It reads from
+// the Scanner up to the start of the next message, which is given either by
+// the Content-Length header of the message or by the next valid From_ line.
+// The body of an MMDF message ends with its closing delimiter line.
+type body struct {
+	m *Scanner
+
+	// length is the number of bytes left according to the Content-Length
+	// header. It is -1 if the body ends at the next From_ line. The end given
+	// by Content-Length is verified once it is reached, falling back to
+	// From_ lines if it turns out to be wrong.
+	length int64
+
+	buf     []byte // data read but not yet returned
+	scratch []byte
+	pending []byte // line ending held back until the next line is read
+	escaped bool   // whether to keep "From " lines escaped
+	started bool   // whether Read has been called
+	done    bool
+	err     error
+
+	// end is the offset of the end of the body within the mbox once it has
+	// been read completely, excluding the line endings separating it from
+	// the next message and the closing delimiter of MMDF.
+	end int64
+
+	lineStart bool // whether the next byte read starts a line
+	emptyLine bool // whether the last line read was empty
+	raw       []byte
+
+	// order lists the names of the header fields of the message in the
+	// order they were read, see Writer.WriteMessageEnvelope.
+	order []string
+}
+
+func newBody(m *Scanner, length int64) *body {
+	// the body follows the empty line ending the header
+	return &body{m: m, length: length, lineStart: true, emptyLine: true}
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	b.started = true
+	for len(b.buf) == 0 {
+		if b.done {
+			return 0, b.err
+		}
+		b.fill()
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+// finish marks the end of the body, with err being io.EOF if the body was
+// read completely.
+func (b *body) finish(err error) {
+	b.done = true
+	b.err = err
+	if err == io.EOF {
+		b.m.pos.End = b.m.read
+	}
+}
+
+// discard reads the rest of the body without returning it.
+func (b *body) discard() {
+	for !b.done {
+		b.buf = nil
+		b.fill()
+	}
+	b.buf = nil
+}
+
+// fill reads the next chunk of the body into buf.
+func (b *body) fill() {
+	m := b.m
+	if b.length > 0 {
+		chunk, err := m.readAtMost(b.length)
+		if err != nil {
+			if err == io.EOF {
+				// the mbox ended before the body
+				err = io.ErrUnexpectedEOF
+				if m.strict {
+					err = m.parseError(TruncatedMessage, err)
+				}
+			}
+			b.finish(err)
+			return
+		}
+		b.length -= int64(len(chunk))
+		b.buf = append(b.scratch[:0], chunk...)
+		b.scratch = b.buf
+		b.lineStart = chunk[len(chunk)-1] == '\n'
+		return
+	}
+	if b.length == 0 {
+		b.length = -1
+		if end := m.read; m.skipLengthEnd() {
+			b.end = end
+			b.finish(io.EOF)
+			return
+		}
+		// The Content-Length header was wrong, so the body continues up
+		// to the next From_ line.
+		if m.strict {
+			b.finish(m.parseError(InvalidContentLength, nil))
+			return
+		}
+		m.diagnose(Diagnostic{Position: Position{m.read, m.read}, Line: m.lines + 1, Reason: InvalidContentLength})
+	}
+
+	if b.lineStart && m.variant == MMDF {
+		if line, _ := m.peekLine(); isMMDFDelimiter(line) {
+			// the closing delimiter is part of the message
+			b.end = m.read
+			if _, err := m.readLine(nil); err != nil && err != io.EOF {
+				b.finish(err)
+				return
+			}
+			b.finish(io.EOF)
+			return
+		}
+	} else if b.lineStart {
+		if head, _ := m.r.Peek(len("From ")); bytes.Equal(head, []byte("From ")) {
+			from, ok := m.atSeparator()
+			if ok {
+				b.end = m.read - int64(len(b.pending))
+				b.finish(io.EOF)
+				return
+			}
+			if from && b.emptyLine && m.strict {
+				// a From_ line following an empty line has to start
+				// a message
+				b.finish(m.parseError(InvalidHeader, nil))
+				return
+			}
+			if from {
+				line, _ := m.peekLine()
+				end := m.read + int64(len(line))
+				m.diagnose(Diagnostic{Position: Position{m.read, end}, Line: m.lines + 1, Reason: InvalidHeader})
+			}
+		}
+	}
+
+	chunk, err := m.readSlice()
+	out := b.scratch[:0]
+	if len(chunk) > 0 {
+		if b.lineStart {
+			out = append(out, b.pending...)
+			b.pending = nil
+			b.emptyLine = isEmptyLine(chunk)
+			if !b.escaped && m.variant == Mboxrd && quotedFrom(chunk) {
+				chunk = chunk[1:]
+			}
+		} else {
+			b.emptyLine = false
+		}
+		b.lineStart = chunk[len(chunk)-1] == '\n'
+		if b.lineStart && m.variant != MMDF {
+			// The line ending preceding the next From_ line belongs
+			// to the separator, not to the message.
+			n := 1
+			if bytes.HasSuffix(chunk, []byte("\r\n")) {
+				n = 2
+			}
+			b.pending = append(b.pending[:0], chunk[len(chunk)-n:]...)
+			chunk = chunk[:len(chunk)-n]
+		}
+		out = append(out, chunk...)
+	}
+
+	switch {
+	case err == io.EOF && m.strict && (!b.lineStart || m.variant == MMDF):
+		b.finish(m.parseError(TruncatedMessage, nil))
+	case err == io.EOF:
+		// The mbox ends with the empty line separating messages.
+		if !b.emptyLine {
+			out = append(out, b.pending...)
+			b.pending = nil
+		}
+		b.end = m.read - int64(len(b.pending))
+		b.pending = nil
+		b.finish(io.EOF)
+	case err != nil:
+		b.finish(err)
+	}
+	b.buf = out
+	b.scratch = out
+}
+
+// rawMessage reads the rest of the message into memory and returns it as
+// found in the mbox, see Scanner.Raw. It returns nil if Read has already been
+// called or the message could not be read completely.
+func (b *body) rawMessage() []byte {
+	if b.raw != nil {
+		return b.raw
+	}
+	if b.started || b.done {
+		return nil
+	}
+
+	m := b.m
+	captured := &bytes.Buffer{}
+	m.capture = captured
+	content := &bytes.Buffer{}
+	b.escaped = true
+	for !b.done {
+		b.fill()
+		content.Write(b.buf)
+	}
+	m.capture = nil
+	if b.err != io.EOF {
+		b.buf = nil
+		return nil
+	}
+
+	b.raw = append(append([]byte{}, m.head...), captured.Bytes()...)
+	b.buf = unescapeMessage(content.Bytes(), m.variant)
+	return b.raw
+}
+
+// memoryBody is the body of a message read into memory by readBody. It keeps
+// the header order of the message, see Writer.WriteMessageEnvelope.
+type memoryBody struct {
+	*bytes.Reader
+	order []string
+}
+
+// readBody reads the body of msg, a message returned by a Scanner, into memory
+// so that it remains readable once the Scanner has moved on.
+func readBody(msg *mail.Message) error {
+	b, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		return err
+	}
+	var order []string
+	if b, ok := msg.Body.(*body); ok {
+		order = b.order
+	}
+	msg.Body = &memoryBody{Reader: bytes.NewReader(b), order: order}
+	return nil
+}
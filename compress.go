@@ -0,0 +1,205 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// ErrUnsupportedCompression is returned when reading or writing data compressed
+// with a Compression that has no decompressor or compressor registered.
+var ErrUnsupportedCompression = errors.New("unsupported compression")
+
+// Compression is a compression format of an mbox file.
+type Compression int
+
+const (
+	// Uncompressed is plain mbox data.
+	Uncompressed Compression = iota
+
+	// Gzip is supported by the standard library for reading and writing.
+	Gzip
+
+	// Bzip2 is supported by the standard library for reading only.
+	Bzip2
+
+	// Xz and Zstd are detected, but not supported by the standard
+	// library. Reading them requires a decompressor registered with
+	// RegisterDecompressor, writing them a compressor registered with
+	// RegisterCompressor.
+	Xz
+	Zstd
+)
+
+var compressionNames = map[Compression]string{
+	Uncompressed: "uncompressed",
+	Gzip:         "gzip",
+	Bzip2:        "bzip2",
+	Xz:           "xz",
+	Zstd:         "zstd",
+}
+
+func (c Compression) String() string {
+	if s, ok := compressionNames[c]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// compressionMagic holds the bytes starting data compressed in each format.
+var compressionMagic = []struct {
+	c     Compression
+	magic []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Bzip2, []byte("BZh")},
+	{Xz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+var (
+	compressorsMu sync.RWMutex
+	decompressors = map[Compression]func(io.Reader) (io.ReadCloser, error){
+		Gzip: func(r io.Reader) (io.ReadCloser, error) {
+			// concatenated members are read as a single stream
+			return gzip.NewReader(r)
+		},
+		Bzip2: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bzip2.NewReader(r)), nil
+		},
+	}
+	compressors = map[Compression]func(io.Writer) (io.WriteCloser, error){
+		Gzip: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+	}
+)
+
+// RegisterDecompressor registers the function returning a reader decompressing
+// data of Compression c, like Xz or Zstd, which the standard library does not
+// support. It replaces a decompressor registered for c before.
+func RegisterDecompressor(c Compression, f func(io.Reader) (io.ReadCloser, error)) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	decompressors[c] = f
+}
+
+// RegisterCompressor registers the function returning a writer compressing
+// data with Compression c. Closing the writer must finish the compressed data
+// without closing the underlying writer. It replaces a compressor registered
+// for c before.
+func RegisterCompressor(c Compression, f func(io.Writer) (io.WriteCloser, error)) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[c] = f
+}
+
+// DetectCompression returns the Compression of data, which is the start of a
+// possibly compressed file.
+func DetectCompression(data []byte) Compression {
+	for _, m := range compressionMagic {
+		if bytes.HasPrefix(data, m.magic) {
+			return m.c
+		}
+	}
+	return Uncompressed
+}
+
+// Decompress returns a reader of the data read from r, decompressing it if it
+// starts with the magic bytes of a supported Compression. The Compression found
+// is returned as well. Closing the reader does not close r.
+//
+// Decompress returns ErrUnsupportedCompression if the data is compressed in a
+// format without a registered decompressor.
+func Decompress(r io.Reader) (io.ReadCloser, Compression, error) {
+	br := bufio.NewReader(r)
+	// a short mbox is not compressed, so errors are left to the first read
+	head, _ := br.Peek(6)
+	c := DetectCompression(head)
+	if c == Uncompressed {
+		return ioutil.NopCloser(br), c, nil
+	}
+
+	compressorsMu.RLock()
+	f, ok := decompressors[c]
+	compressorsMu.RUnlock()
+	if !ok {
+		return nil, c, ErrUnsupportedCompression
+	}
+	rc, err := f(br)
+	return rc, c, err
+}
+
+// compressedFile closes a decompressing reader together with its file.
+type compressedFile struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (c compressedFile) Close() error {
+	err := c.ReadCloser.Close()
+	if ferr := c.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// Open opens the mbox file name for reading with a Scanner. A compressed file
+// is decompressed transparently, see Decompress. An uncompressed file is
+// returned as *os.File, so that a Scanner knows its size, see
+// Scanner.SetProgress.
+//
+// Gzip and bzip2 files are supported by the standard library. Opening an xz or
+// zstd file returns ErrUnsupportedCompression unless a decompressor has been
+// registered with RegisterDecompressor.
+func Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	rc, c, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if c == Uncompressed {
+		// the data peeked at is read again, unless f cannot seek
+		if _, err := f.Seek(0, io.SeekStart); err == nil {
+			return f, nil
+		}
+	}
+	return compressedFile{rc, f}, nil
+}
+
+// NewCompressedWriter creates a new *Writer that writes messages to w,
+// compressed with c. Close must be called to finish the compressed data.
+//
+// Gzip data is written as a new member, so appending it to an existing gzip
+// file keeps the file readable as a whole. Other formats than Gzip require a
+// compressor registered with RegisterCompressor, otherwise
+// ErrUnsupportedCompression is returned.
+func NewCompressedWriter(w io.Writer, c Compression) (*Writer, error) {
+	if c == Uncompressed {
+		return NewWriter(w), nil
+	}
+
+	compressorsMu.RLock()
+	f, ok := compressors[c]
+	compressorsMu.RUnlock()
+	if !ok {
+		return nil, ErrUnsupportedCompression
+	}
+	cw, err := f(w)
+	if err != nil {
+		return nil, err
+	}
+	mw := NewWriter(cw)
+	mw.c = cw
+	return mw, nil
+}
@@ -0,0 +1,172 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bzip2Mbox is a bzip2 compressed mbox of a single message with the subject
+// "bzip2".
+const bzip2Mbox = "\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\x13\x68\x14\x97\x00\x00\x12\xdf\x80\x00\x10\x40\x01\x72\x10\x41\x50\x0c\x00\x3a\x77\xd6\x50\x20\x00\x54\x25\x50\x06\x80\x34\x1e\xa0\x7a\x7a\xa0\xd4\xf4\x42\x69\xa3\x40\x34\xc8\x68\x23\x91\xe7\x9a\x18\x5c\x6c\x91\x69\xea\x61\xaa\x23\x88\x52\x3b\x4b\xe1\x67\x09\x89\x31\xe4\xb3\xd1\xc6\x4b\xa8\xcd\xc7\x6e\x4e\xd7\xbb\x90\x83\x06\xb3\x51\xf0\x84\xc3\x95\x25\x79\x8f\xe2\xee\x48\xa7\x0a\x12\x02\x6d\x02\x92\xe0"
+
+// subjects returns the subjects of the messages of the mbox read from r.
+func subjects(t *testing.T, r io.Reader) []string {
+	var s []string
+	m := NewScanner(r, false)
+	for m.Next() {
+		s = append(s, m.Message().Header.Get("Subject"))
+	}
+	if m.Err() != nil {
+		t.Fatal(m.Err())
+	}
+	return s
+}
+
+func TestDecompress(t *testing.T) {
+	plain := followTestMessage("plain")
+	for _, test := range []struct {
+		data        string
+		compression Compression
+		subjects    string
+	}{
+		{plain, Uncompressed, "plain"},
+		{"", Uncompressed, ""},
+		{bzip2Mbox, Bzip2, "bzip2"},
+	} {
+		r, c, err := Decompress(strings.NewReader(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != test.compression {
+			t.Errorf("Expected %v, got %v", test.compression, c)
+		}
+		if s := strings.Join(subjects(t, r), ","); s != test.subjects {
+			t.Errorf("Expected subjects %q, got %q", test.subjects, s)
+		}
+	}
+
+	if _, c, err := Decompress(strings.NewReader("\xfd7zXZ\x00")); c != Xz || err != ErrUnsupportedCompression {
+		t.Errorf("Expected %v for xz, got %v", ErrUnsupportedCompression, err)
+	}
+	if _, err := NewCompressedWriter(ioutil.Discard, Bzip2); err != ErrUnsupportedCompression {
+		t.Errorf("Expected %v for bzip2, got %v", ErrUnsupportedCompression, err)
+	}
+}
+
+func TestCompressedWriterAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "mbox.gz")
+
+	// each Writer appends a gzip member to the file
+	for _, subject := range []string{"1", "2"} {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := NewCompressedWriter(f, Gzip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := &mail.Message{
+			Header: mail.Header{"From": {"herp.derp@example.com"}, "Subject": {subject}},
+			Body:   strings.NewReader("Hello.\n"),
+		}
+		if _, err := w.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		t.Fatal("Expected gzip data")
+	}
+	r, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if s := strings.Join(subjects(t, r), ","); s != "1,2" {
+		t.Errorf("Expected subjects %q, got %q", "1,2", s)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the size of an uncompressed file is known while it is read
+	name := filepath.Join(dir, "mbox")
+	plain := followTestMessage("plain")
+	if err := ioutil.WriteFile(name, []byte(plain), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	m := NewScanner(r, false)
+	var p Progress
+	m.SetProgress(func(progress Progress) {
+		p = progress
+	})
+	for m.Next() {
+	}
+	if m.Err() != nil {
+		t.Fatal(m.Err())
+	}
+	if expected := (Progress{Read: int64(len(plain)), Size: int64(len(plain)), Messages: 1}); p != expected {
+		t.Errorf("Expected progress %+v, got %+v", expected, p)
+	}
+
+	// xz is read once a decompressor is registered, here for a fake format
+	// of the magic bytes followed by plain data
+	name = filepath.Join(dir, "mbox.xz")
+	if err := ioutil.WriteFile(name, []byte("\xfd7zXZ\x00"+followTestMessage("xz")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(name); err != ErrUnsupportedCompression {
+		t.Errorf("Expected %v for xz, got %v", ErrUnsupportedCompression, err)
+	}
+	RegisterDecompressor(Xz, func(r io.Reader) (io.ReadCloser, error) {
+		if _, err := io.CopyN(ioutil.Discard, r, 6); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(r), nil
+	})
+	defer func() {
+		compressorsMu.Lock()
+		delete(decompressors, Xz)
+		compressorsMu.Unlock()
+	}()
+	r, err = Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if s := strings.Join(subjects(t, r), ","); s != "xz" {
+		t.Errorf("Expected subjects %q, got %q", "xz", s)
+	}
+}
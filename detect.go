@@ -0,0 +1,188 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// detectSize is the number of bytes at the start of an mbox examined to detect
+// its variant.
+const detectSize = 64 * 1024
+
+// Detection is the result of guessing the variant of an mbox.
+type Detection struct {
+	// Variant is the most likely variant of the mbox.
+	Variant Variant
+
+	// Confidence ranges from 0 for a mere guess to 1 for certainty.
+	Confidence float64
+
+	// CRLF is true if the majority of lines is terminated by "\r\n".
+	CRLF bool
+}
+
+// Detect guesses the variant of the mbox provided by r from its first 64 KiB.
+// These bytes are consumed from r.
+func Detect(r io.Reader) (Detection, error) {
+	sample := make([]byte, detectSize)
+	n, err := io.ReadFull(r, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Detection{}, err
+	}
+	return detect(sample[:n], err != nil), nil
+}
+
+// DetectAt guesses the variant of the mbox provided by r from its first 64 KiB.
+func DetectAt(r io.ReaderAt) (Detection, error) {
+	sample := make([]byte, detectSize)
+	n, err := r.ReadAt(sample, 0)
+	if err != nil && err != io.EOF {
+		return Detection{}, err
+	}
+	return detect(sample[:n], n < len(sample)), nil
+}
+
+// nextLine returns the line of data starting at pos without its line ending
+// and the position of the following line. If the line is not terminated, next
+// is -1.
+func nextLine(data []byte, pos int) (line []byte, next int) {
+	e := bytes.IndexByte(data[pos:], '\n')
+	if e == -1 {
+		return data[pos:], -1
+	}
+	return bytes.TrimSuffix(data[pos:pos+e], []byte("\r")), pos + e + 1
+}
+
+// quotedFrom reports whether line matches ">+From ".
+func quotedFrom(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) &&
+		bytes.HasPrefix(line, []byte(">"))
+}
+
+// detect guesses the variant of an mbox starting with sample. atEOF is true if
+// sample is the whole mbox.
+func detect(sample []byte, atEOF bool) Detection {
+	var (
+		lf, crlf   int
+		messages   int
+		withLength int // messages with a Content-Length pointing to the next message
+		badLength  int // messages with a missing or wrong Content-Length
+		quoted     int // lines matching ">From "
+		requoted   int // lines matching ">>+From "
+		unquoted   int // lines matching "From " inside a Content-Length body
+	)
+
+	if line, next := nextLine(sample, 0); next != -1 && isMMDFDelimiter(line) {
+		return Detection{
+			Variant:    MMDF,
+			Confidence: 1,
+			CRLF:       bytes.HasSuffix(sample[:next], []byte("\r\n")),
+		}
+	}
+
+	bodyEnd := -1
+	for pos := 0; pos < len(sample); {
+		line, next := nextLine(sample, pos)
+		if next == -1 && !atEOF {
+			break
+		}
+		if next != -1 {
+			if bytes.HasSuffix(sample[:next], []byte("\r\n")) {
+				crlf++
+			} else {
+				lf++
+			}
+		}
+
+		switch {
+		case pos < bodyEnd:
+			if bytes.HasPrefix(line, []byte("From ")) {
+				unquoted++
+			}
+		case isFromLine(line) && next != -1:
+			bodyEnd = -1
+			messages++
+			length, bodyStart, ok := parseContentLength(sample, next)
+			if !ok {
+				badLength++
+				break
+			}
+			end := bodyStart + length
+			if end > len(sample) {
+				// cannot be verified with this sample
+				withLength++
+				bodyEnd = end
+				next = bodyStart
+				break
+			}
+			if ok, more := validLengthEnd(sample[end:], atEOF); ok || more {
+				withLength++
+				bodyEnd = end
+			} else {
+				badLength++
+			}
+			next = bodyStart
+		}
+		if bytes.HasPrefix(line, []byte(">>")) && quotedFrom(line) {
+			requoted++
+		} else if quotedFrom(line) {
+			quoted++
+		}
+
+		if next == -1 {
+			break
+		}
+		pos = next
+	}
+
+	d := Detection{CRLF: crlf > lf}
+	switch {
+	case messages == 0:
+		d.Variant, d.Confidence = Mboxo, 0
+	case withLength > 0 && badLength == 0 && unquoted > 0:
+		d.Variant, d.Confidence = Mboxcl2, 0.95
+	case withLength > 0 && badLength == 0 && quoted+requoted > 0:
+		d.Variant, d.Confidence = Mboxcl, 0.9
+	case withLength > 0 && badLength == 0:
+		d.Variant, d.Confidence = Mboxcl2, 0.6
+	case requoted > 0:
+		d.Variant, d.Confidence = Mboxrd, 0.9
+	case quoted > 0:
+		// Without ">>From " lines mboxo and mboxrd cannot be told apart.
+		// They read ">From " lines differently, as mboxrd removes the '>',
+		// so guessing wrong changes the bodies.
+		d.Variant, d.Confidence = Mboxo, 0.3
+	default:
+		// Without any quoted "From " lines mboxo and mboxrd cannot be told
+		// apart, but neither can they be read differently.
+		d.Variant, d.Confidence = Mboxo, 0.5
+	}
+	if withLength > 0 && badLength > 0 {
+		// inconsistent Content-Length headers
+		d.Confidence *= float64(badLength) / float64(messages)
+	}
+	return d
+}
+
+// parseContentLength parses the header starting at pos in data and returns the value
+// of its Content-Length header and the position of the body.
+func parseContentLength(data []byte, pos int) (length, bodyStart int, ok bool) {
+	e := headerEnd(data[pos:])
+	if e == -1 {
+		return 0, 0, false
+	}
+	bodyStart = pos + e
+	tpr := textproto.NewReader(bufio.NewReader(bytes.NewReader(data[pos:bodyStart])))
+	header, err := tpr.ReadMIMEHeader()
+	if err != nil {
+		return 0, 0, false
+	}
+	length, err = strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return 0, 0, false
+	}
+	return length, bodyStart, true
+}
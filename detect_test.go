@@ -0,0 +1,135 @@
+package mbox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		variant       Variant
+		minConfidence float64
+		crlf          bool
+	}{
+		{
+			name:    "empty",
+			data:    "",
+			variant: Mboxo,
+		},
+		{
+			name:          "mboxo",
+			data:          mboxWithThreeMessages,
+			variant:       Mboxo,
+			minConfidence: 0.3,
+		},
+		{
+			name:          "mboxo without quoted From lines",
+			data:          strings.Replace(mboxWithThreeMessages, ">From Herp", "Love from Herp", 1),
+			variant:       Mboxo,
+			minConfidence: 0.5,
+		},
+		{
+			name:          "mboxrd",
+			data:          mboxrdWithEscapedFroms,
+			variant:       Mboxrd,
+			minConfidence: 0.9,
+		},
+		{
+			name:          "mboxcl2",
+			data:          mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody)),
+			variant:       Mboxcl2,
+			minConfidence: 0.9,
+		},
+		{
+			name: "mboxcl",
+			data: strings.Replace(mboxclMessages(len(mboxclFirstBody)+1, len(mboxclSecondBody)),
+				"\nFrom derp", "\n>From derp", 1),
+			variant:       Mboxcl,
+			minConfidence: 0.9,
+		},
+		{
+			name:          "wrong Content-Length",
+			data:          mboxclMessages(10, len(mboxclSecondBody)),
+			variant:       Mboxo,
+			minConfidence: 0,
+		},
+		{
+			name:          "crlf",
+			data:          strings.Replace(mboxrdWithEscapedFroms, "\n", "\r\n", -1),
+			variant:       Mboxrd,
+			minConfidence: 0.9,
+			crlf:          true,
+		},
+	}
+	for _, test := range tests {
+		d, err := Detect(strings.NewReader(test.data))
+		if err != nil {
+			t.Fatalf("%s - Unexpected error: %v", test.name, err)
+		}
+		if d.Variant != test.variant {
+			t.Errorf("%s - Expected variant %v, got %v", test.name, test.variant, d.Variant)
+		}
+		if d.Confidence < test.minConfidence || d.Confidence > 1 {
+			t.Errorf("%s - Unexpected confidence %v", test.name, d.Confidence)
+		}
+		if d.CRLF != test.crlf {
+			t.Errorf("%s - Expected CRLF %v, got %v", test.name, test.crlf, d.CRLF)
+		}
+
+		da, err := DetectAt(strings.NewReader(test.data))
+		if err != nil {
+			t.Fatalf("%s - Unexpected error: %v", test.name, err)
+		}
+		if da != d {
+			t.Errorf("%s - DetectAt returned %+v, Detect %+v", test.name, da, d)
+		}
+	}
+}
+
+func TestDetectAmbiguousQuotedFrom(t *testing.T) {
+	// ">From " lines are read differently by mboxo and mboxrd
+	if d := detect([]byte(mboxWithThreeMessages), true); d.Confidence >= 0.5 {
+		t.Errorf("Expected a confidence below 0.5, got %v", d.Confidence)
+	}
+}
+
+func TestDetectTruncatedSample(t *testing.T) {
+	data := mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody))
+	data = strings.Repeat(" ", detectSize-len(data)/2) + "\n" + data
+	d, err := Detect(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Variant != Mboxcl2 {
+		t.Errorf("Expected variant %v, got %v", Mboxcl2, d.Variant)
+	}
+}
+
+func TestScannerAuto(t *testing.T) {
+	m := NewScanner(strings.NewReader(mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody))), false)
+	m.SetVariant(Auto)
+	if m.Variant() != Auto {
+		t.Errorf("Expected variant %v before Next(), got %v", Auto, m.Variant())
+	}
+	for i, expected := range []string{mboxclFirstBody, mboxclSecondBody} {
+		if !m.Next() {
+			t.Fatalf("Next() failed; pass %d: %v", i, m.Err())
+		}
+		body := new(bytes.Buffer)
+		if _, err := body.ReadFrom(m.Message().Body); err != nil {
+			t.Fatalf("Unexpected error reading message body: %v", err)
+		}
+		if body.String() != expected {
+			t.Errorf("%d - Expected:\n %q\ngot\n%q", i, expected, body.String())
+		}
+	}
+	if m.Next() {
+		t.Errorf("Next() succeeded")
+	}
+	if m.Variant() != Mboxcl2 {
+		t.Errorf("Expected variant %v, got %v", Mboxcl2, m.Variant())
+	}
+}
@@ -0,0 +1,109 @@
+package mbox
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Envelope is the From_ line preceding every message in an mbox. It records
+// the envelope sender of the message and the time it was delivered.
+type Envelope struct {
+	// Sender is the envelope sender, usually an address.
+	Sender string
+
+	// Date is the time of delivery. It is the zero time if the date of the
+	// From_ line could not be parsed.
+	Date time.Time
+
+	// Raw is the From_ line as found in the mbox, without its line ending.
+	// It is empty for envelopes not read from an mbox.
+	Raw string
+}
+
+// envelopeLayouts are the date formats found in From_ lines in the wild. They
+// are tried after runs of spaces have been collapsed.
+var envelopeLayouts = []string{
+	"Mon Jan 2 15:04:05 2006",
+	"Mon Jan 2 15:04:05 MST 2006",
+	"Mon Jan 2 15:04:05 -0700 2006",
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"Mon Jan 2 15:04:05 2006 MST",
+	"Mon Jan 2 15:04:05 MST -0700 2006",
+	"Mon Jan 2 15:04 2006",
+	"Mon Jan 2 15:04 MST 2006",
+	"Jan 2 15:04:05 2006",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+}
+
+var weekdays = map[string]bool{
+	"Mon": true, "Tue": true, "Wed": true, "Thu": true, "Fri": true, "Sat": true, "Sun": true,
+}
+
+var months = map[string]bool{
+	"Jan": true, "Feb": true, "Mar": true, "Apr": true, "May": true, "Jun": true,
+	"Jul": true, "Aug": true, "Sep": true, "Oct": true, "Nov": true, "Dec": true,
+}
+
+// ParseEnvelope parses a From_ line like
+//
+//	From herp.derp@example.com  Thu Jan  1 00:00:01 2015
+//
+// with or without its line ending. Besides the asctime format it accepts time
+// zones before or after the year, a missing weekday or missing seconds, and
+// the "remote from" suffix of UUCP.
+//
+// If the sender can be determined but the date cannot be parsed, ParseEnvelope
+// returns an error together with an *Envelope lacking the Date.
+func ParseEnvelope(line string) (*Envelope, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "From ") {
+		return nil, errors.New("mbox: envelope does not start with \"From \"")
+	}
+	e := &Envelope{Raw: line}
+
+	rest := line[len("From "):]
+	if i := strings.Index(rest, " remote from "); i != -1 {
+		rest = rest[:i]
+	}
+
+	// The sender may contain spaces, as in mailing list archives obscuring
+	// addresses. The date starts with the first weekday or month name
+	// followed by a day.
+	fields := strings.Fields(rest)
+	date := len(fields)
+	for i := 1; i < len(fields); i++ {
+		name := strings.TrimSuffix(fields[i], ",")
+		if weekdays[name] || (months[name] && i+1 < len(fields)) {
+			date = i
+			break
+		}
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("mbox: envelope without sender")
+	}
+	e.Sender = strings.Join(fields[:date], " ")
+	if date == len(fields) {
+		return e, errors.New("mbox: envelope without date")
+	}
+
+	value := strings.Join(fields[date:], " ")
+	for _, layout := range envelopeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			e.Date = t
+			return e, nil
+		}
+	}
+	if t, err := mail.ParseDate(value); err == nil {
+		e.Date = t
+		return e, nil
+	}
+	return e, errors.New("mbox: cannot parse envelope date " + value)
+}
+
+// String returns the From_ line of e without a line ending, formatting Sender
+// and Date like asctime.
+func (e *Envelope) String() string {
+	return "From " + e.Sender + " " + e.Date.Format(time.ANSIC)
+}
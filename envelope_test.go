@@ -0,0 +1,126 @@
+package mbox
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	tests := []struct {
+		line        string
+		sender      string
+		date        time.Time
+		yieldsError bool
+	}{
+		{
+			line:   "From herp.derp@example.com Thu Jan  1 00:00:01 2015",
+			sender: "herp.derp@example.com",
+			date:   time.Date(2015, 1, 1, 0, 0, 1, 0, time.UTC),
+		},
+		{
+			line:   "From herp.derp at example.com  Thu Jan  1 00:00:01 2015\n",
+			sender: "herp.derp at example.com",
+			date:   time.Date(2015, 1, 1, 0, 0, 1, 0, time.UTC),
+		},
+		{
+			line:   "From herp.derp@example.com Thu Jan 15 13:14:15 2015 +0100\r\n",
+			sender: "herp.derp@example.com",
+			date:   time.Date(2015, 1, 15, 12, 14, 15, 0, time.UTC),
+		},
+		{
+			line:   "From herp.derp@example.com Thu Jan 15 13:14:15 -0200 2015",
+			sender: "herp.derp@example.com",
+			date:   time.Date(2015, 1, 15, 15, 14, 15, 0, time.UTC),
+		},
+		{
+			line:   "From herp.derp@example.com Thu Jan 15 13:14:15 UTC 2015",
+			sender: "herp.derp@example.com",
+			date:   time.Date(2015, 1, 15, 13, 14, 15, 0, time.UTC),
+		},
+		{
+			line:   "From derp!herp Thu Jan 15 13:14 2015 remote from example",
+			sender: "derp!herp",
+			date:   time.Date(2015, 1, 15, 13, 14, 0, 0, time.UTC),
+		},
+		{
+			line:   "From MAILER-DAEMON Jan 15 13:14:15 2015",
+			sender: "MAILER-DAEMON",
+			date:   time.Date(2015, 1, 15, 13, 14, 15, 0, time.UTC),
+		},
+		{
+			line:        "From one place.  2014",
+			sender:      "one place. 2014",
+			yieldsError: true,
+		},
+		{
+			line:        "From herp.derp@example.com Thu Jan 99 00:00:01 2015",
+			sender:      "herp.derp@example.com",
+			yieldsError: true,
+		},
+	}
+	for _, test := range tests {
+		e, err := ParseEnvelope(test.line)
+		if err == nil && test.yieldsError {
+			t.Errorf("%q - unexpected success", test.line)
+		}
+		if err != nil && !test.yieldsError {
+			t.Errorf("%q - unexpected error: %v", test.line, err)
+		}
+		if e == nil {
+			t.Errorf("%q - envelope is nil", test.line)
+			continue
+		}
+		if e.Sender != test.sender {
+			t.Errorf("%q - Expected sender %q, got %q", test.line, test.sender, e.Sender)
+		}
+		if !e.Date.Equal(test.date) {
+			t.Errorf("%q - Expected date %v, got %v", test.line, test.date, e.Date)
+		}
+		if e.Raw != strings.TrimRight(test.line, "\r\n") {
+			t.Errorf("%q - Unexpected raw line %q", test.line, e.Raw)
+		}
+	}
+}
+
+func TestParseEnvelopeInvalid(t *testing.T) {
+	for _, line := range []string{"", "From:", "From ", ">From herp.derp@example.com Thu Jan  1 00:00:01 2015"} {
+		if e, err := ParseEnvelope(line); err == nil || e != nil {
+			t.Errorf("%q - Expected error, got %v, %v", line, e, err)
+		}
+	}
+}
+
+func TestEnvelopeString(t *testing.T) {
+	e := &Envelope{Sender: "herp.derp@example.com", Date: time.Date(2015, 1, 1, 0, 0, 1, 0, time.UTC)}
+	if s := e.String(); s != "From herp.derp@example.com Thu Jan  1 00:00:01 2015" {
+		t.Errorf("Unexpected From_ line %q", s)
+	}
+}
+
+func TestScannerEnvelopeSuffixes(t *testing.T) {
+	lines := []string{
+		"From herp.derp@example.com Thu Jan 15 13:14:15 2015 +0100",
+		"From herp.derp@example.com Thu Jan 15 13:14:15 2015 PST",
+		"From derp!herp Thu Jan 15 13:14 2015 remote from example",
+		"From herp.derp@example.com Thu, 15 Jan 2015 13:14:15 -0700",
+	}
+	var mbox string
+	for i, line := range lines {
+		mbox += line + "\nFrom: herp.derp@example.com\nSubject: " + strconv.Itoa(i) + "\n\nHello.\n\n"
+	}
+	m := NewScanner(strings.NewReader(mbox), false)
+	n := 0
+	for ; m.Next(); n++ {
+		if n < len(lines) && m.Envelope().Raw != lines[n] {
+			t.Errorf("Expected From_ line %q, got %q", lines[n], m.Envelope().Raw)
+		}
+	}
+	if m.Err() != nil {
+		t.Fatal(m.Err())
+	}
+	if n != len(lines) {
+		t.Errorf("Expected %d messages, got %d", len(lines), n)
+	}
+}
@@ -0,0 +1,101 @@
+package mbox
+
+import (
+	"fmt"
+)
+
+// Reason classifies the ways an mbox can be malformed.
+type Reason int
+
+const (
+	// NoFromLine means data was found where a From_ line, or the delimiter
+	// line of an MMDF message, was expected.
+	NoFromLine Reason = iota + 1
+
+	// InvalidHeader means the header of a message could not be parsed.
+	InvalidHeader
+
+	// TruncatedMessage means the mbox ended in the middle of a message.
+	TruncatedMessage
+
+	// InvalidContentLength means the Content-Length header of a message
+	// does not point to the end of the message.
+	InvalidContentLength
+
+	// TrailingData means the mbox ends with data that is not part of a
+	// message.
+	TrailingData
+)
+
+var reasonNames = map[Reason]string{
+	NoFromLine:           "no From_ line",
+	InvalidHeader:        "invalid header",
+	TruncatedMessage:     "truncated message",
+	InvalidContentLength: "invalid Content-Length",
+	TrailingData:         "trailing data",
+}
+
+func (r Reason) String() string {
+	if s, ok := reasonNames[r]; ok {
+		return s
+	}
+	return "unknown reason"
+}
+
+// ParseError is the error returned by a Scanner in strict mode if the mbox is
+// malformed. errors.Is reports it to be ErrInvalidMboxFormat.
+type ParseError struct {
+	// Offset is the position of the problem within the mbox.
+	Offset int64
+
+	// Line is the number of the line at Offset, counting from 1.
+	Line int
+
+	Reason Reason
+
+	// Err is the error that occured parsing the header, if any.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	s := fmt.Sprintf("%v: line %d (offset %d): %v", ErrInvalidMboxFormat, e.Line, e.Offset, e.Reason)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// Is reports whether target is ErrInvalidMboxFormat.
+func (e *ParseError) Is(target error) bool {
+	return target == ErrInvalidMboxFormat
+}
+
+// Unwrap returns the error that occured parsing the header, if any.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Diagnostic describes a problem in an mbox that a Scanner in lenient mode
+// recovered from, see Scanner.SetDiagnostics.
+type Diagnostic struct {
+	// Position is the part of the mbox affected. Start equals End if the
+	// problem did not cause anything to be skipped.
+	Position
+
+	// Line is the number of the line at Start, counting from 1.
+	Line int
+
+	Reason Reason
+
+	// Err is the error that occured parsing the header or a Content-Length
+	// header, if any.
+	Err error
+}
+
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("line %d (offset %d-%d): %v", d.Line, d.Start, d.End, d.Reason)
+	if d.Err != nil {
+		s += ": " + d.Err.Error()
+	}
+	return s
+}
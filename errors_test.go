@@ -0,0 +1,25 @@
+package mbox
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	err := error(&ParseError{Offset: 172, Line: 7, Reason: TruncatedMessage, Err: io.ErrUnexpectedEOF})
+	if got, expected := err.Error(), "invalid mbox format: line 7 (offset 172): truncated message: unexpected EOF"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if !errors.Is(err, ErrInvalidMboxFormat) {
+		t.Errorf("Expected %v to be ErrInvalidMboxFormat", err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected %v to wrap io.ErrUnexpectedEOF", err)
+	}
+
+	err = &ParseError{Offset: 0, Line: 1, Reason: NoFromLine}
+	if got, expected := err.Error(), "invalid mbox format: line 1 (offset 0): no From_ line"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
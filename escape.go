@@ -0,0 +1,164 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+)
+
+// escaper is an io.Writer escaping the "From " lines of a message body, or the
+// delimiter lines for MMDF, for a Writer while it is written. It converts line
+// endings on the fly and holds back at most the start of a line that may turn
+// out to need escaping, so a body of any size is written with bounded memory.
+type escaper struct {
+	w       io.Writer
+	variant Variant
+	newline []byte
+	keep    bool  // whether to keep line endings, using newline for the last line only
+	n       int64 // bytes written to w
+
+	escapes  bool   // whether the variant escapes lines at all
+	pattern  string // "From ", or the delimiter for MMDF
+	line     bool   // whether only lines equal to pattern are escaped
+	deciding bool   // whether the start of the current line is held back
+	quotes   int    // '>' held back at the start of a line, for Mboxrd
+	prefix   []byte // start of pattern held back
+	cr       bool   // whether a '\r' has been held back
+	midLine  bool   // whether the current line has content
+	err      error
+}
+
+func newEscaper(w io.Writer, v Variant, newline string) *escaper {
+	escapes, pattern := v.escapes()
+	return &escaper{
+		w:        w,
+		variant:  v,
+		newline:  []byte(newline),
+		escapes:  escapes,
+		pattern:  pattern,
+		line:     v == MMDF,
+		deciding: escapes,
+		prefix:   make([]byte, 0, len(pattern)),
+	}
+}
+
+// write writes b to the underlying writer, recording the first error.
+func (e *escaper) write(b []byte) {
+	if e.err != nil || len(b) == 0 {
+		return
+	}
+	n, err := e.w.Write(b)
+	e.n += int64(n)
+	e.err = err
+}
+
+// release writes the start of the line held back, escaping it if escape is
+// true.
+func (e *escaper) release(escape bool) {
+	e.deciding = false
+	if escape || e.quotes > 0 || len(e.prefix) > 0 {
+		e.midLine = true
+	}
+	if escape {
+		e.write([]byte(">"))
+	}
+	for ; e.quotes > 0; e.quotes-- {
+		e.write([]byte(">"))
+	}
+	e.write(e.prefix)
+	e.prefix = e.prefix[:0]
+}
+
+// endLine writes a line ending, converting the line ending found.
+func (e *escaper) endLine(found string) {
+	if e.deciding {
+		e.release(false)
+	}
+	if e.keep {
+		e.write([]byte(found))
+	} else {
+		e.write(e.newline)
+	}
+	e.midLine = false
+	e.deciding = e.escapes
+}
+
+func (e *escaper) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && e.err == nil {
+		if e.cr {
+			e.cr = false
+			if p[0] == '\n' {
+				e.endLine("\r\n")
+				p = p[1:]
+				continue
+			}
+			// a lone '\r' is not a line ending
+			if e.deciding {
+				e.release(false)
+			}
+			e.write([]byte("\r"))
+		}
+
+		if e.deciding {
+			c := p[0]
+			switch {
+			case c == '>' && e.variant == Mboxrd && len(e.prefix) == 0:
+				e.quotes++
+				p = p[1:]
+			case len(e.prefix) < len(e.pattern) && c == e.pattern[len(e.prefix)]:
+				e.prefix = append(e.prefix, c)
+				p = p[1:]
+				if len(e.prefix) == len(e.pattern) && !e.line {
+					e.release(true)
+				}
+			case len(e.prefix) == len(e.pattern) && (c == '\r' || c == '\n'):
+				// the line consists of the pattern only
+				e.release(true)
+			default:
+				e.release(false)
+			}
+			continue
+		}
+
+		i := bytes.IndexAny(p, "\r\n")
+		if i == -1 {
+			e.write(p)
+			e.midLine = true
+			break
+		}
+		if i > 0 {
+			e.write(p[:i])
+			e.midLine = true
+		}
+		if p[i] == '\n' {
+			e.endLine("\n")
+		} else {
+			e.cr = true
+		}
+		p = p[i+1:]
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+	return n, nil
+}
+
+// Close writes anything held back and terminates the last line of the body if
+// necessary. It does not close the underlying writer.
+func (e *escaper) Close() error {
+	if e.cr {
+		e.cr = false
+		if e.deciding {
+			e.release(false)
+		}
+		e.write([]byte("\r"))
+	}
+	if e.deciding && (e.quotes > 0 || len(e.prefix) > 0) {
+		e.release(e.line && len(e.prefix) == len(e.pattern))
+	}
+	if e.midLine {
+		e.write(e.newline)
+		e.midLine = false
+	}
+	return e.err
+}
@@ -0,0 +1,52 @@
+package mbox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEscapeBody(t *testing.T) {
+	tests := []struct {
+		variant  Variant
+		newline  string
+		body     string
+		expected string
+	}{
+		{Mboxo, "\n", "From the start.\nFrom Herp\n>From Derp\n", ">From the start.\n>From Herp\n>From Derp\n"},
+		{Mboxo, "\n", "Fro\nFrom\nFrom", "Fro\nFrom\nFrom\n"},
+		{Mboxrd, "\n", "From the start.\n>From Herp\n>>From Derp\n>> From\n", ">From the start.\n>>From Herp\n>>>From Derp\n>> From\n"},
+		{Mboxcl, "\n", "From the start.\n>From Herp\n", ">From the start.\n>From Herp\n"},
+		{Mboxcl2, "\n", "From the start.\n>From Herp\n", "From the start.\n>From Herp\n"},
+		{Mboxo, "\r\n", "Herp\nFrom Derp\r\n\r\nBye.", "Herp\r\n>From Derp\r\n\r\nBye.\r\n"},
+		{Mboxo, "\n", "Carriage\rreturn\r\r\n", "Carriage\rreturn\r\n"},
+		{Mboxrd, "\n", ">>>", ">>>\n"},
+		{Mboxo, "\n", "", ""},
+		{MMDF, "\n", "From the start.\n\x01\x01\x01\x01\n\x01\x01\x01\x01 \n\x01\x01\x01", "From the start.\n>\x01\x01\x01\x01\n\x01\x01\x01\x01 \n\x01\x01\x01\n"},
+		{MMDF, "\r\n", "\x01\x01\x01\x01\r\nBye.\n\x01\x01\x01\x01", ">\x01\x01\x01\x01\r\nBye.\r\n>\x01\x01\x01\x01\r\n"},
+	}
+	for _, test := range tests {
+		// read a byte at a time to split lines across writes
+		b := &bytes.Buffer{}
+		n, err := escapeBody(b, iotest.OneByteReader(strings.NewReader(test.body)), test.variant, test.newline, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.expected {
+			t.Errorf("%v: Expected %q escaping %q, got %q", test.variant, test.expected, test.body, b.String())
+		}
+		if n != int64(b.Len()) {
+			t.Errorf("%v: Expected %d bytes written, got %d", test.variant, b.Len(), n)
+		}
+	}
+
+	// line endings are kept for Writer.WriteRaw
+	b := &bytes.Buffer{}
+	if _, err := escapeBody(b, strings.NewReader("Herp\r\nFrom Derp\nBye."), Mboxo, "\r\n", true); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Herp\r\n>From Derp\nBye.\r\n"; b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,246 @@
+package mbox
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// Follower reads the messages of an mbox file while it is appended to, like
+// tail -f. A message is only delivered once it is complete: when a following
+// message has started, or when the file has not changed for a while and is not
+// locked.
+//
+// If the mbox is truncated or rewritten, which is noticed by the data before
+// the current offset changing, the Follower starts over at the beginning of the
+// file and delivers all messages again.
+type Follower struct {
+	name     string
+	offset   int64
+	variant  Variant
+	interval time.Duration
+	quiet    time.Duration
+	locked   func(name string) (bool, error)
+
+	sum     uint32 // checksum of the data preceding offset
+	summed  bool   // whether sum has been computed
+	info    os.FileInfo
+	changed time.Time // time the file was last seen changing
+}
+
+// NewFollower returns a new *Follower to read the mbox file name, starting at
+// offset. offset must be 0 or the start of a message, like a value returned by
+// Offset.
+func NewFollower(name string, offset int64) *Follower {
+	return &Follower{
+		name:     name,
+		offset:   offset,
+		interval: time.Second,
+		quiet:    5 * time.Second,
+		locked:   dotLocked,
+	}
+}
+
+// dotLocked reports whether the mbox file name is locked by a dot lock file.
+func dotLocked(name string) (bool, error) {
+	_, err := os.Stat(name + ".lock")
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetVariant sets the mbox variant, see Scanner.SetVariant. The default is
+// Mboxo.
+func (f *Follower) SetVariant(v Variant) {
+	f.variant = v
+}
+
+// SetInterval sets how often the file is checked for new messages. The default
+// is one second.
+func (f *Follower) SetInterval(d time.Duration) {
+	f.interval = d
+}
+
+// SetQuiescence sets how long the file must not have changed before its last
+// message is taken to be complete. The default is five seconds.
+func (f *Follower) SetQuiescence(d time.Duration) {
+	f.quiet = d
+}
+
+// SetLocked sets the function reporting whether the mbox file name is locked
+// by the program appending to it. The last message of a locked file is not
+// delivered. By default, the file is locked if the dot lock file name+".lock"
+// exists.
+func (f *Follower) SetLocked(locked func(name string) (bool, error)) {
+	f.locked = locked
+}
+
+// Offset returns the offset the Follower continues reading at, which is the end
+// of the last message delivered. It may be called from the function passed to
+// Follow, to store the offset and later resume with NewFollower.
+func (f *Follower) Offset() int64 {
+	return f.offset
+}
+
+// Follow reads the messages of the mbox and calls fn for each of them, one at a
+// time, checking for new messages until ctx is done. It returns the first
+// error, including an error returned by fn or the error of ctx once it is done.
+// A message at the end of the file that cannot be parsed may still be being
+// written, so it is read again on the next check and only fails Follow once the
+// file is quiet and not locked.
+func (f *Follower) Follow(ctx context.Context, fn func(ParsedMessage) error) error {
+	t := time.NewTicker(f.interval)
+	defer t.Stop()
+	for {
+		if err := f.poll(time.Now(), fn); err != nil {
+			return err
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// checksum returns the checksum of the data preceding the offset of f.
+func (f *Follower) checksum(r io.ReaderAt) (uint32, error) {
+	n := int64(fingerprintSize)
+	if f.offset < n {
+		n = f.offset
+	}
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, f.offset-n); err != nil && err != io.EOF {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(b), nil
+}
+
+// restart starts reading the mbox over at its beginning.
+func (f *Follower) restart() {
+	f.offset = 0
+	f.sum = crc32.ChecksumIEEE(nil)
+	f.summed = true
+}
+
+// deliver calls fn with msg and continues reading at end.
+func (f *Follower) deliver(r io.ReaderAt, msg ParsedMessage, end int64, fn func(ParsedMessage) error) error {
+	f.offset = end
+	var err error
+	if f.sum, err = f.checksum(r); err != nil {
+		return err
+	}
+	return fn(msg)
+}
+
+// poll delivers the messages completed since the last call.
+func (f *Follower) poll(now time.Time, fn func(ParsedMessage) error) error {
+	file, err := os.Open(f.name)
+	if os.IsNotExist(err) {
+		// the mbox is being replaced
+		if f.offset > 0 {
+			f.restart()
+		}
+		f.info = nil
+		f.changed = now
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	if f.info == nil || !os.SameFile(f.info, fi) || fi.Size() != f.info.Size() || !fi.ModTime().Equal(f.info.ModTime()) {
+		f.changed = now
+	}
+	if size < f.offset || f.info != nil && !os.SameFile(f.info, fi) {
+		f.restart()
+	}
+	f.info = fi
+	sum, err := f.checksum(file)
+	if err != nil {
+		return err
+	}
+	if !f.summed {
+		f.sum, f.summed = sum, true
+	} else if sum != f.sum {
+		f.restart()
+	}
+	if size == f.offset {
+		return nil
+	}
+
+	v := f.variant
+	if v == Auto {
+		d, err := DetectAt(io.NewSectionReader(file, 0, size))
+		if err != nil {
+			return err
+		}
+		v = d.Variant
+	}
+
+	// a message is complete once the next one has started
+	base := f.offset
+	m := NewScanner(io.NewSectionReader(file, base, size-base), false)
+	m.SetVariant(v)
+	var pending *ParsedMessage
+	var tailErr error
+	for m.Next() {
+		if pending != nil {
+			if err := f.deliver(file, *pending, base+m.Position().Start, fn); err != nil {
+				return err
+			}
+			pending = nil
+		}
+		msg := m.Message()
+		if tailErr = readBody(msg); tailErr != nil {
+			break
+		}
+		pos := m.Position()
+		pos.Start += base
+		pos.End += base
+		pending = &ParsedMessage{Position: pos, Envelope: m.Envelope(), Message: msg}
+	}
+	if tailErr == nil {
+		tailErr = m.Err()
+	}
+	if tailErr != nil {
+		// The message failing may still be being written. The pending
+		// message ended where it starts, and it is read again by the next
+		// poll.
+		if pending != nil {
+			if err := f.deliver(file, *pending, pending.End, fn); err != nil {
+				return err
+			}
+		}
+		if settled, err := f.settled(now); err != nil || !settled {
+			return err
+		}
+		return tailErr
+	}
+	if pending == nil {
+		return nil
+	}
+	if settled, err := f.settled(now); err != nil || !settled {
+		return err
+	}
+	return f.deliver(file, *pending, size, fn)
+}
+
+// settled reports whether the file has not changed for the quiescence period
+// and is not locked, so that its last message is complete.
+func (f *Follower) settled(now time.Time) (bool, error) {
+	if now.Sub(f.changed) < f.quiet {
+		return false, nil
+	}
+	locked, err := f.locked(f.name)
+	return err == nil && !locked, err
+}
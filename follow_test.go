@@ -0,0 +1,199 @@
+package mbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func followTestMessage(subject string) string {
+	return fmt.Sprintf("From herp.derp@example.com  Thu Jan  1 00:00:01 2015\n"+
+		"From: herp.derp@example.com\nSubject: %s\n\nHello.\n\n", subject)
+}
+
+func TestFollower(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "mbox")
+	appendMbox := func(data string) {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(name+".lock", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	appendMbox(followTestMessage("1") + followTestMessage("2"))
+
+	f := NewFollower(name, 0)
+	f.SetInterval(5 * time.Millisecond)
+	f.SetQuiescence(50 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	subjects := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- f.Follow(ctx, func(msg ParsedMessage) error {
+			subjects <- fmt.Sprintf("%s %d-%d", msg.Message.Header.Get("Subject"), msg.Start, f.Offset())
+			return nil
+		})
+	}()
+	expect := func(subject string) {
+		t.Helper()
+		select {
+		case s := <-subjects:
+			if s != subject {
+				t.Errorf("Expected message %q, got %q", subject, s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected message %q, got none", subject)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case s := <-subjects:
+			t.Errorf("Expected no message, got %q", s)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	size := int64(len(followTestMessage("1")))
+	expect(fmt.Sprintf("1 0-%d", size))
+	// the last message is incomplete while the mbox is locked
+	expectNone()
+	appendMbox(followTestMessage("3"))
+	expect(fmt.Sprintf("2 %d-%d", size, 2*size))
+	expectNone()
+	if err := os.Remove(name + ".lock"); err != nil {
+		t.Fatal(err)
+	}
+	expect(fmt.Sprintf("3 %d-%d", 2*size, 3*size))
+
+	// a rewritten mbox is read again from the start
+	if err := ioutil.WriteFile(name, []byte(followTestMessage("4")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expect(fmt.Sprintf("4 0-%d", size))
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestFollowerHeaderOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "mbox")
+	mbox := "From herp.derp@example.com Thu Jan  1 00:00:01 2015\n" +
+		"Subject: Test\nX-Mailer: Herp\nFrom: herp.derp@example.com\n\nTest.\n\n"
+	if err := ioutil.WriteFile(name, []byte(mbox), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFollower(name, 0)
+	f.SetQuiescence(0)
+	b := &bytes.Buffer{}
+	w := NewWriter(b)
+	w.SetLineEnding(LF)
+	if err := f.poll(time.Now(), func(msg ParsedMessage) error {
+		_, err := w.WriteMessageEnvelope(msg.Message, msg.Envelope)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != mbox {
+		t.Errorf("Invalid mbox output:\n%q\nexpected:\n%q", b.String(), mbox)
+	}
+}
+
+func TestFollowerPartialAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "mbox")
+	appendMbox := func(data string) {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var subjects []string
+	poll := func(f *Follower) error {
+		return f.poll(time.Now(), func(msg ParsedMessage) error {
+			subjects = append(subjects, fmt.Sprintf("%s %d-%d", msg.Message.Header.Get("Subject"), msg.Start, f.Offset()))
+			return nil
+		})
+	}
+
+	// the second message is appended in two writes, split inside its header
+	second := "From herp.derp@example.com  Thu Jan  1 00:00:01 2015\n" +
+		"From: herp.derp@example.com\nSubject: 2\nX-Y: z\nDate: Thu, 01 Jan 2015 00:00:01 +0000\n\nHello.\n\n"
+	split := strings.Index(second, "Date:") + len("Dat")
+	appendMbox(followTestMessage("1") + second[:split])
+
+	f := NewFollower(name, 0)
+	f.SetQuiescence(time.Hour)
+	if err := poll(f); err != nil {
+		t.Fatalf("Expected the incomplete message to be retried, got %v", err)
+	}
+	size := int64(len(followTestMessage("1")))
+	if expected := fmt.Sprintf("1 0-%d", size); len(subjects) != 1 || subjects[0] != expected {
+		t.Fatalf("Expected message %q, got %q", expected, subjects)
+	}
+	appendMbox(second[split:])
+	f.SetQuiescence(0)
+	if err := poll(f); err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("2 %d-%d", size, size+int64(len(second))); len(subjects) != 2 || subjects[1] != expected {
+		t.Errorf("Expected message %q, got %q", expected, subjects)
+	}
+
+	// a tail that cannot be parsed is an error once the file is quiet and
+	// unlocked
+	appendMbox(second[:split])
+	f.SetQuiescence(time.Hour)
+	if err := poll(f); err != nil {
+		t.Errorf("Expected no error while the file is changing, got %v", err)
+	}
+	f.SetQuiescence(0)
+	f.SetLocked(func(string) (bool, error) { return true, nil })
+	if err := poll(f); err != nil {
+		t.Errorf("Expected no error while the file is locked, got %v", err)
+	}
+	f.SetLocked(func(string) (bool, error) { return false, nil })
+	if err := poll(f); err == nil {
+		t.Error("Expected an error for the unparsable tail, got none")
+	}
+	if len(subjects) != 2 {
+		t.Errorf("Expected no more messages, got %q", subjects[2:])
+	}
+}
@@ -0,0 +1,385 @@
+package mbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrStaleIndex is returned when an Index does not match the mbox it is used
+// with, because the mbox has been appended to or rewritten since the Index
+// was built.
+var ErrStaleIndex = errors.New("stale index")
+
+// ErrMessageNotFound is returned by Archive if a message is not part of the
+// mbox.
+var ErrMessageNotFound = errors.New("message not found")
+
+// fingerprintSize is the number of bytes at the start and the end of an mbox
+// used to tell whether an Index still matches it.
+const fingerprintSize = 4096
+
+// indexMagic is the first line of a serialized Index.
+const indexMagic = "mbox index 2"
+
+// IndexEntry describes a single message of an indexed mbox.
+type IndexEntry struct {
+	Position
+	MessageID string
+	Date      string
+	From      string
+	Subject   string
+}
+
+// Index records the position and some headers of every message of an mbox. It
+// allows an Archive to access the messages directly.
+type Index struct {
+	// Variant is the variant the mbox was read with.
+	Variant Variant
+
+	// Size is the size of the mbox in bytes.
+	Size int64
+
+	// Head and Tail are the CRC-32 checksums of the first and last 4 KiB of
+	// the mbox.
+	Head, Tail uint32
+
+	// ModTime is the modification time of the mbox file, recorded by
+	// OpenArchive. It is the zero time if it is not known.
+	ModTime time.Time
+
+	Entries []IndexEntry
+}
+
+// fingerprint returns the checksums of the first and last 4 KiB of the mbox
+// provided by r.
+func fingerprint(r io.ReaderAt, size int64) (head, tail uint32, err error) {
+	checksum := func(off int64) (uint32, error) {
+		n := int64(fingerprintSize)
+		if size-off < n {
+			n = size - off
+		}
+		b := make([]byte, n)
+		if _, err := r.ReadAt(b, off); err != nil && err != io.EOF {
+			return 0, err
+		}
+		return crc32.ChecksumIEEE(b), nil
+	}
+
+	if head, err = checksum(0); err != nil {
+		return
+	}
+	tail = head
+	if size > fingerprintSize {
+		tail, err = checksum(size - fingerprintSize)
+	}
+	return
+}
+
+// BuildIndex reads the size bytes of mbox data provided by r and returns an
+// Index of its messages. v is the variant to read the mbox with; if it is
+// Auto, the Index records the detected variant.
+func BuildIndex(r io.ReaderAt, size int64, v Variant) (*Index, error) {
+	ix := &Index{Size: size}
+	var err error
+	if ix.Head, ix.Tail, err = fingerprint(r, size); err != nil {
+		return nil, err
+	}
+
+	m := NewScanner(io.NewSectionReader(r, 0, size), false)
+	m.SetVariant(v)
+	for m.Next() {
+		msg := m.Message()
+		if _, err := io.Copy(ioutil.Discard, msg.Body); err != nil {
+			return nil, err
+		}
+		ix.Entries = append(ix.Entries, IndexEntry{
+			Position:  m.Position(),
+			MessageID: msg.Header.Get("Message-Id"),
+			Date:      msg.Header.Get("Date"),
+			From:      msg.Header.Get("From"),
+			Subject:   msg.Header.Get("Subject"),
+		})
+	}
+	if m.Err() != nil {
+		return nil, m.Err()
+	}
+	ix.Variant = m.Variant()
+	return ix, nil
+}
+
+// WriteTo writes ix to w in a line based text format.
+func (ix *Index) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var N int64
+	var mtime int64
+	if !ix.ModTime.IsZero() {
+		mtime = ix.ModTime.UnixNano()
+	}
+	n, err := fmt.Fprintf(bw, "%s\nvariant %s\nsize %d\nhead %08x\ntail %08x\nmtime %d\n",
+		indexMagic, ix.Variant, ix.Size, ix.Head, ix.Tail, mtime)
+	N += int64(n)
+	if err != nil {
+		return N, err
+	}
+	for _, e := range ix.Entries {
+		n, err = fmt.Fprintf(bw, "%d %d %q %q %q %q\n",
+			e.Start, e.End, e.MessageID, e.Date, e.From, e.Subject)
+		N += int64(n)
+		if err != nil {
+			return N, err
+		}
+	}
+	return N, bw.Flush()
+}
+
+// ReadIndex reads an Index written by Index.WriteTo from r.
+func ReadIndex(r io.Reader) (*Index, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	var header []string
+	for len(header) < 6 && s.Scan() {
+		header = append(header, s.Text())
+	}
+	if len(header) < 6 {
+		if s.Err() != nil {
+			return nil, s.Err()
+		}
+		return nil, fmt.Errorf("invalid index: %v", io.ErrUnexpectedEOF)
+	}
+	if header[0] != indexMagic {
+		return nil, errors.New("invalid index: unknown format")
+	}
+	ix := &Index{}
+	var variant string
+	var mtime int64
+	if _, err := fmt.Sscanf(strings.Join(header[1:], "\n"), "variant %s\nsize %d\nhead %x\ntail %x\nmtime %d",
+		&variant, &ix.Size, &ix.Head, &ix.Tail, &mtime); err != nil {
+		return nil, fmt.Errorf("invalid index: %v", err)
+	}
+	if mtime != 0 {
+		ix.ModTime = time.Unix(0, mtime)
+	}
+	ix.Variant = Auto
+	for v, name := range variantNames {
+		if name == variant {
+			ix.Variant = v
+		}
+	}
+	if ix.Variant == Auto {
+		return nil, fmt.Errorf("invalid index: unknown variant %q", variant)
+	}
+
+	for line := 7; s.Scan(); line++ {
+		e, err := parseIndexEntry(s.Text())
+		if err != nil {
+			return nil, fmt.Errorf("invalid index: line %d: %v", line, err)
+		}
+		ix.Entries = append(ix.Entries, e)
+	}
+	return ix, s.Err()
+}
+
+// parseIndexEntry parses a line written by Index.WriteTo for a single message.
+func parseIndexEntry(line string) (IndexEntry, error) {
+	var e IndexEntry
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 {
+		return e, errors.New("missing position")
+	}
+	var err error
+	if e.Start, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return e, err
+	}
+	if e.End, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return e, err
+	}
+
+	rest := fields[2]
+	for _, v := range []*string{&e.MessageID, &e.Date, &e.From, &e.Subject} {
+		q, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return e, err
+		}
+		if *v, err = strconv.Unquote(q); err != nil {
+			return e, err
+		}
+		rest = strings.TrimPrefix(rest[len(q):], " ")
+	}
+	return e, nil
+}
+
+// check returns ErrStaleIndex if ix does not match the size bytes of mbox data
+// provided by r. Only the size and the checksums of the start and the end of
+// the mbox are compared, so a rewrite changing neither goes unnoticed, like an
+// MUA changing a Status header in the middle of the mbox.
+func (ix *Index) check(r io.ReaderAt, size int64) error {
+	if size != ix.Size {
+		return ErrStaleIndex
+	}
+	head, tail, err := fingerprint(r, size)
+	if err != nil {
+		return err
+	}
+	if head != ix.Head || tail != ix.Tail {
+		return ErrStaleIndex
+	}
+	return nil
+}
+
+// Archive provides random access to the messages of an indexed mbox.
+type Archive struct {
+	r     io.ReaderAt
+	index *Index
+	ids   map[string]int
+	c     io.Closer
+}
+
+// NewArchive returns a new *Archive to read the messages of the size bytes of
+// mbox data provided by r, located using index. It returns ErrStaleIndex if
+// index does not match the mbox.
+//
+// The mbox is compared to index by its size and the checksums of its first and
+// last 4 KiB only. A change in between that keeps the size, like an MUA marking
+// a message as read, is not noticed by NewArchive, but by OpenArchive, which
+// also compares the modification time of the file.
+func NewArchive(r io.ReaderAt, size int64, index *Index) (*Archive, error) {
+	if err := index.check(r, size); err != nil {
+		return nil, err
+	}
+	a := &Archive{r: r, index: index, ids: make(map[string]int, len(index.Entries))}
+	for i, e := range index.Entries {
+		if id := normalizeMessageID(e.MessageID); id != "" {
+			if _, ok := a.ids[id]; !ok {
+				a.ids[id] = i
+			}
+		}
+	}
+	return a, nil
+}
+
+// OpenArchive opens the mbox file name for random access. The index is read
+// from the sidecar file name+".idx". If it is missing or stale, or the mbox has
+// been modified since the index was built, it is rebuilt reading the mbox as
+// variant v and written to the sidecar file.
+func OpenArchive(name string, v Variant) (*Archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	a, err := openArchive(f, name+".idx", v)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a.c = f
+	return a, nil
+}
+
+func openArchive(f *os.File, indexName string, v Variant) (*Archive, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if idx, err := os.Open(indexName); err == nil {
+		index, err := ReadIndex(idx)
+		idx.Close()
+		if err == nil && index.ModTime.Equal(fi.ModTime()) {
+			a, err := NewArchive(f, fi.Size(), index)
+			if err != ErrStaleIndex {
+				return a, err
+			}
+		}
+	}
+
+	index, err := BuildIndex(f, fi.Size(), v)
+	if err != nil {
+		return nil, err
+	}
+	index.ModTime = fi.ModTime()
+	idx, err := os.Create(indexName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := index.WriteTo(idx); err != nil {
+		idx.Close()
+		return nil, err
+	}
+	if err := idx.Close(); err != nil {
+		return nil, err
+	}
+	return NewArchive(f, fi.Size(), index)
+}
+
+// Close closes the mbox file of an Archive returned by OpenArchive. It does
+// nothing for an Archive returned by NewArchive.
+func (a *Archive) Close() error {
+	if a.c == nil {
+		return nil
+	}
+	return a.c.Close()
+}
+
+// Index returns the index of a.
+func (a *Archive) Index() *Index {
+	return a.index
+}
+
+// Len returns the number of messages in a.
+func (a *Archive) Len() int {
+	return len(a.index.Entries)
+}
+
+// Message returns the i-th message of a, counting from 0. It returns
+// ErrMessageNotFound if there is no such message and ErrStaleIndex if the
+// index does not point to a message.
+func (a *Archive) Message(i int) (*mail.Message, error) {
+	if i < 0 || i >= len(a.index.Entries) {
+		return nil, ErrMessageNotFound
+	}
+	p := a.index.Entries[i].Position
+
+	// every message starts with a From_ line, or a delimiter line for MMDF
+	marker := "From "
+	if a.index.Variant == MMDF {
+		marker = mmdfDelimiter
+	}
+	start := make([]byte, len(marker))
+	if _, err := a.r.ReadAt(start, p.Start); err != nil || string(start) != marker {
+		return nil, ErrStaleIndex
+	}
+
+	m := NewScanner(io.NewSectionReader(a.r, p.Start, p.Len()), false)
+	m.SetVariant(a.index.Variant)
+	if !m.Next() {
+		if m.Err() != nil {
+			return nil, m.Err()
+		}
+		return nil, ErrStaleIndex
+	}
+	return m.Message(), nil
+}
+
+// MessageByID returns the first message of a with Message-ID id, with or
+// without angle brackets. It returns ErrMessageNotFound if there is no such
+// message.
+func (a *Archive) MessageByID(id string) (*mail.Message, error) {
+	i, ok := a.ids[normalizeMessageID(id)]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	return a.Message(i)
+}
+
+func normalizeMessageID(id string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+}
@@ -0,0 +1,229 @@
+package mbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testArchiveMessages(t *testing.T, a *Archive) {
+	if a.Len() != 3 {
+		t.Fatalf("Expected 3 messages, got %d", a.Len())
+	}
+	for i, subject := range []string{"Test", "Another test", "A last test"} {
+		msg, err := a.Message(i)
+		if err != nil {
+			t.Fatalf("%d - Unexpected error: %v", i, err)
+		}
+		if msg.Header.Get("Subject") != subject {
+			t.Errorf("%d - Unexpected subject %q", i, msg.Header.Get("Subject"))
+		}
+	}
+	msg, err := a.MessageByID("<second@example.com>")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if msg.Header.Get("Subject") != "Another test" {
+		t.Errorf("Unexpected subject %q", msg.Header.Get("Subject"))
+	}
+	if _, err := a.MessageByID("third@example.com"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := a.MessageByID("fourth@example.com"); err != ErrMessageNotFound {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+	if _, err := a.Message(3); err != ErrMessageNotFound {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+}
+
+var mboxWithMessageIDs = strings.Replace(strings.Replace(strings.Replace(mboxWithStartingLF,
+	"Subject: Test\n", "Subject: Test\nMessage-ID: <first@example.com>\n", 1),
+	"Subject: Another test\n", "Subject: Another test\nMessage-ID: <second@example.com>\n", 1),
+	"Subject: A last test\n", "Subject: A last test\nMessage-ID: <third@example.com>\n", 1)
+
+func TestIndex(t *testing.T) {
+	r := strings.NewReader(mboxWithMessageIDs)
+	ix, err := BuildIndex(r, r.Size(), Auto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Variant != Mboxo {
+		t.Errorf("Expected variant %v, got %v", Mboxo, ix.Variant)
+	}
+	if len(ix.Entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(ix.Entries))
+	}
+	e := ix.Entries[1]
+	if e.MessageID != "<second@example.com>" || e.Subject != "Another test" ||
+		e.From != "derp.herp at example.com (Derp Herp)" || e.Date != "Thu, 02 Jan 2015 00:00:01 +0100" {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if !strings.HasPrefix(mboxWithMessageIDs[e.Start:e.End], "From derp.herp") {
+		t.Errorf("Unexpected position %+v", e.Position)
+	}
+
+	b := &bytes.Buffer{}
+	if _, err := ix.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadIndex(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Variant != ix.Variant || read.Size != ix.Size || read.Head != ix.Head || read.Tail != ix.Tail || !read.ModTime.IsZero() {
+		t.Errorf("Index changed after reading it back: %+v, expected %+v", read, ix)
+	}
+	for i := range ix.Entries {
+		if read.Entries[i] != ix.Entries[i] {
+			t.Errorf("Entry %d changed after reading it back: %+v, expected %+v", i, read.Entries[i], ix.Entries[i])
+		}
+	}
+
+	a, err := NewArchive(r, r.Size(), read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testArchiveMessages(t, a)
+}
+
+func TestIndexMMDF(t *testing.T) {
+	r := strings.NewReader(mmdfWithTwoMessages)
+	ix, err := BuildIndex(r, r.Size(), Auto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Variant != MMDF {
+		t.Errorf("Expected variant %v, got %v", MMDF, ix.Variant)
+	}
+	b := &bytes.Buffer{}
+	if _, err := ix.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	if ix, err = ReadIndex(b); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewArchive(r, r.Size(), ix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Len() != 2 {
+		t.Fatalf("Expected 2 messages, got %d", a.Len())
+	}
+	for i, subject := range []string{"First", "Second"} {
+		msg, err := a.Message(i)
+		if err != nil {
+			t.Fatalf("%d - Unexpected error: %v", i, err)
+		}
+		if msg.Header.Get("Subject") != subject {
+			t.Errorf("%d - Unexpected subject %q", i, msg.Header.Get("Subject"))
+		}
+	}
+}
+
+func TestReadIndexInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"mbox index 1\nvariant mboxo\nsize 1\nhead 0\ntail 0\nmtime 0\n",
+		"mbox index 2\nvariant mboxx\nsize 1\nhead 0\ntail 0\nmtime 0\n",
+		"mbox index 2\nvariant mboxo\nsize x\nhead 0\ntail 0\nmtime 0\n",
+		"mbox index 2\nvariant mboxo\nsize 1\nhead 0\ntail 0\n",
+		"mbox index 2\nvariant mboxo\nsize 1\nhead 0\ntail 0\nmtime 0\n1 2 \"id\"\n",
+	} {
+		if _, err := ReadIndex(strings.NewReader(s)); err == nil {
+			t.Errorf("%q - unexpected success", s)
+		}
+	}
+}
+
+func TestArchiveStale(t *testing.T) {
+	r := strings.NewReader(mboxWithMessageIDs)
+	ix, err := BuildIndex(r, r.Size(), Mboxo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		mboxWithMessageIDs + mboxWithOneMessage,
+		strings.Replace(mboxWithMessageIDs, "Bye.", "Bye!", -1),
+		mboxWithMessageIDs[:len(mboxWithMessageIDs)-1],
+	} {
+		r := strings.NewReader(s)
+		if _, err := NewArchive(r, r.Size(), ix); err != ErrStaleIndex {
+			t.Errorf("Expected ErrStaleIndex, got %v", err)
+		}
+	}
+}
+
+func TestOpenArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "mbox")
+	if err := ioutil.WriteFile(name, []byte(mboxWithMessageIDs), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		a, err := OpenArchive(name, Mboxo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testArchiveMessages(t, a)
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(name + ".idx"); err != nil {
+			t.Fatalf("Missing index: %v", err)
+		}
+	}
+
+	// a change keeping the size and the checksums is noticed by the
+	// modification time
+	padding := strings.Repeat("Padding.\n", 1000)
+	padded := strings.Replace(strings.Replace(mboxWithMessageIDs,
+		"This is a simple test.\n", "This is a simple test.\n"+padding, 1),
+		"This is another simple test.\n", "This is another simple test.\n"+padding, 1)
+	if err := ioutil.WriteFile(name, []byte(padded), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := OpenArchive(name, Mboxo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+	modified := strings.Replace(padded, "Subject: Another test", "Subject: Another tset", 1)
+	if err := ioutil.WriteFile(name, []byte(modified), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(name, later, later); err != nil {
+		t.Fatal(err)
+	}
+	a, err = OpenArchive(name, Mboxo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject := a.Index().Entries[1].Subject; subject != "Another tset" {
+		t.Errorf("Expected the modified subject after rebuilding the index, got %q", subject)
+	}
+	a.Close()
+
+	// appending to the mbox makes the sidecar stale
+	if err := ioutil.WriteFile(name, []byte(mboxWithMessageIDs+mboxWithOneMessage), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err = OpenArchive(name, Mboxo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if a.Len() != 4 {
+		t.Errorf("Expected 4 messages after rebuilding the index, got %d", a.Len())
+	}
+}
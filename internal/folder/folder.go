@@ -0,0 +1,93 @@
+// Package folder holds what the packages maildir and mh have in common: they
+// keep every message in a file of its own and convert to and from the messages
+// read and written by package mbox.
+package folder
+
+import (
+	"bufio"
+	"net/mail"
+	"os"
+	"time"
+
+	"github.com/mzimmerman/mbox"
+	"github.com/mzimmerman/mbox/internal/mailheader"
+)
+
+// File is a message file opened for reading.
+type File struct {
+	f *os.File
+
+	// Message is the message of the file. Its body is read from the file.
+	Message *mail.Message
+
+	// Envelope is a From_ line for the message. The sender is taken from
+	// the header, the date is the modification time of the file.
+	Envelope *mbox.Envelope
+}
+
+// Open opens the message file path and reads its header.
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	m, err := mail.ReadMessage(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	env := &mbox.Envelope{Sender: mailheader.Sender(m.Header), Date: fi.ModTime().UTC()}
+	return &File{f: f, Message: m, Envelope: env}, nil
+}
+
+// Close closes the file, after which the body of its message can no longer be
+// read.
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// Scanner reads the messages of a folder, like mbox.Scanner reads the messages
+// of an mbox.
+type Scanner interface {
+	Next() bool
+	Message() *mail.Message
+	Envelope() *mbox.Envelope
+	Err() error
+}
+
+// Import calls deliver for the remaining messages read by s, with their header
+// as found in the mbox without the Status and X-Status fields, and with the
+// date of their From_ line, if any. It returns the number of messages
+// delivered.
+func Import(s *mbox.Scanner, deliver func(header []byte, m *mail.Message, date time.Time) error) (int, error) {
+	n := 0
+	for s.Next() {
+		var date time.Time
+		if env := s.Envelope(); env != nil {
+			date = env.Date
+		}
+		if err := deliver(mailheader.Strip(s.RawHeader(), "Status", "X-Status"), s.Message(), date); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, s.Err()
+}
+
+// Export writes the remaining messages read by s to w, with their From_ lines
+// taken from s.Envelope. It returns the number of messages written.
+func Export(w *mbox.Writer, s Scanner) (int, error) {
+	n := 0
+	for s.Next() {
+		if _, err := w.WriteMessageEnvelope(s.Message(), s.Envelope()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, s.Err()
+}
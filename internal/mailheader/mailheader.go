@@ -0,0 +1,113 @@
+// Package mailheader handles message headers for package mbox and the packages
+// converting between mboxes and other mail stores.
+package mailheader
+
+import (
+	"bytes"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// Write writes header to w, followed by an empty line, with every line ending
+// in newline. The fields named in order are written first, in that order,
+// followed by the remaining fields sorted by name.
+func Write(w io.Writer, header textproto.MIMEHeader, order []string, newline string) (N int, err error) {
+	var n int
+
+	written := make(map[string]int, len(header))
+	writeField := func(name string) error {
+		values := header[name]
+		if written[name] >= len(values) {
+			return nil
+		}
+		value := values[written[name]]
+		written[name]++
+		n, err := io.WriteString(w, name+": "+value+newline)
+		N += n
+		return err
+	}
+
+	for _, name := range order {
+		if err = writeField(name); err != nil {
+			return
+		}
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for written[name] < len(header[name]) {
+			if err = writeField(name); err != nil {
+				return
+			}
+		}
+	}
+
+	n, err = io.WriteString(w, newline)
+	N += n
+	return
+}
+
+// FieldName returns the canonical name of the header field starting at line,
+// or "" if line is a continuation line or has no name.
+func FieldName(line []byte) string {
+	if len(line) == 0 || line[0] == ' ' || line[0] == '\t' {
+		return ""
+	}
+	i := bytes.IndexByte(line, ':')
+	if i <= 0 {
+		return ""
+	}
+	return textproto.CanonicalMIMEHeaderKey(string(bytes.TrimRight(line[:i], " \t")))
+}
+
+// Strip returns a copy of header, a header as found in the mail store, without
+// the fields named, including their continuation lines. The remaining fields
+// are kept unchanged.
+func Strip(header []byte, names ...string) []byte {
+	strip := make(map[string]bool, len(names))
+	for _, name := range names {
+		strip[textproto.CanonicalMIMEHeaderKey(name)] = true
+	}
+	var out []byte
+	skip := false
+	for len(header) > 0 {
+		line := header
+		if e := bytes.IndexByte(header, '\n'); e != -1 {
+			line, header = header[:e+1], header[e+1:]
+		} else {
+			header = nil
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			skip = strip[FieldName(line)]
+		}
+		if !skip {
+			out = append(out, line...)
+		}
+	}
+	return out
+}
+
+// Sender returns the envelope sender of a message with header h, as written to
+// the From_ line by mbox.Writer. It is taken from the Return-Path, Sender or
+// From header, in that order, and defaults to MAILER-DAEMON.
+func Sender(h mail.Header) string {
+	if path := strings.TrimSpace(h.Get("Return-Path")); path != "" {
+		// "<>" is the null sender of bounces
+		path = strings.TrimSuffix(strings.TrimPrefix(path, "<"), ">")
+		if path != "" && !strings.ContainsAny(path, " \t") {
+			return path
+		}
+	}
+	for _, name := range []string{"Sender", "From"} {
+		if list, err := h.AddressList(name); err == nil && len(list) > 0 && list[0].Address != "" {
+			return list[0].Address
+		}
+	}
+	return "MAILER-DAEMON"
+}
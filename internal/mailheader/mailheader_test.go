@@ -0,0 +1,30 @@
+package mailheader
+
+import (
+	"net/mail"
+	"testing"
+)
+
+func TestStrip(t *testing.T) {
+	header := "Subject: Test\r\nstatus: RO\r\nX-Status: F\r\n\tfolded\r\nFrom: herp.derp@example.com\r\n\r\n"
+	expected := "Subject: Test\r\nFrom: herp.derp@example.com\r\n\r\n"
+	if got := string(Strip([]byte(header), "Status", "x-status")); got != expected {
+		t.Errorf("Expected header %q, got %q", expected, got)
+	}
+}
+
+func TestSender(t *testing.T) {
+	for _, test := range []struct {
+		header   mail.Header
+		expected string
+	}{
+		{mail.Header{"Return-Path": {"<bounce@example.com>"}, "From": {"herp.derp@example.com"}}, "bounce@example.com"},
+		{mail.Header{"Return-Path": {"<>"}, "Sender": {"list@example.com"}}, "list@example.com"},
+		{mail.Header{"From": {"Herp Derp <herp.derp@example.com>"}}, "herp.derp@example.com"},
+		{mail.Header{}, "MAILER-DAEMON"},
+	} {
+		if got := Sender(test.header); got != test.expected {
+			t.Errorf("%v: Expected sender %q, got %q", test.header, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+//go:build go1.23
+
+package mbox
+
+import (
+	"io"
+	"iter"
+	"net/mail"
+)
+
+// Item is a message yielded by Scanner.Items together with its From_ line and
+// location within the mbox.
+type Item struct {
+	Envelope *Envelope
+	Message  *mail.Message
+
+	// Offset is the position of the first byte of the From_ line.
+	Offset int64
+}
+
+// Messages returns an iterator over the messages of the mbox read from r. See
+// Scanner.Messages.
+func Messages(r io.Reader) iter.Seq2[*mail.Message, error] {
+	return NewScanner(r, false).Messages()
+}
+
+// MessagesFile returns an iterator over the messages of the mbox file name,
+// read as variant v. The file is opened with Open when iteration starts and
+// closed when it ends, even if the loop is left early.
+func MessagesFile(name string, v Variant) iter.Seq2[*mail.Message, error] {
+	return func(yield func(*mail.Message, error) bool) {
+		f, err := Open(name)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer f.Close()
+		m := NewScanner(f, false)
+		m.SetVariant(v)
+		m.Messages()(yield)
+	}
+}
+
+// Messages returns an iterator over the remaining messages of m, like calling
+// Next and Message in a loop. If an error occurs, it is yielded with a nil
+// message as the last element. The body of a message can only be read until
+// the loop continues with the next message.
+func (m *Scanner) Messages() iter.Seq2[*mail.Message, error] {
+	return func(yield func(*mail.Message, error) bool) {
+		for m.Next() {
+			if !yield(m.Message(), nil) {
+				return
+			}
+		}
+		if m.Err() != nil {
+			yield(nil, m.Err())
+		}
+	}
+}
+
+// Items returns an iterator over the remaining messages of m like Messages,
+// yielding each message together with its From_ line and offset.
+func (m *Scanner) Items() iter.Seq2[Item, error] {
+	return func(yield func(Item, error) bool) {
+		for m.Next() {
+			item := Item{Envelope: m.Envelope(), Message: m.Message(), Offset: m.Position().Start}
+			if !yield(item, nil) {
+				return
+			}
+		}
+		if m.Err() != nil {
+			yield(Item{}, m.Err())
+		}
+	}
+}
+
+// Messages returns an iterator over the remaining messages of b, like
+// Scanner.Messages.
+func (b *BabylScanner) Messages() iter.Seq2[*mail.Message, error] {
+	return func(yield func(*mail.Message, error) bool) {
+		for b.Next() {
+			if !yield(b.Message(), nil) {
+				return
+			}
+		}
+		if b.Err() != nil {
+			yield(nil, b.Err())
+		}
+	}
+}
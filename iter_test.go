@@ -0,0 +1,116 @@
+//go:build go1.23
+
+package mbox
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestMessages(t *testing.T) {
+	var subjects []string
+	for msg, err := range Messages(strings.NewReader(mboxWithThreeMessages)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		subjects = append(subjects, msg.Header.Get("Subject"))
+	}
+	if got := strings.Join(subjects, ", "); got != "Test, Another test, A last test" {
+		t.Errorf("Unexpected subjects %q", got)
+	}
+
+	// an error is yielded last
+	readErr := errors.New("read error")
+	n := 0
+	var last error
+	for msg, err := range Messages(io.MultiReader(strings.NewReader(mboxWithThreeMessages[:300]), iotest.ErrReader(readErr))) {
+		if err != nil {
+			last = err
+			continue
+		}
+		if msg == nil {
+			t.Errorf("message %d is nil", n)
+		}
+		n++
+	}
+	if last != readErr {
+		t.Errorf("Expected error %v, got %v", readErr, last)
+	}
+}
+
+func TestScannerItems(t *testing.T) {
+	m := NewScanner(strings.NewReader(mboxWithThreeMessages), false)
+	var offsets []int64
+	for item, err := range m.Items() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Envelope == nil || item.Message == nil {
+			t.Fatalf("Incomplete item %+v", item)
+		}
+		offsets = append(offsets, item.Offset)
+		if len(offsets) == 2 {
+			break
+		}
+	}
+	if len(offsets) != 2 || offsets[0] != 0 || offsets[1] != int64(strings.Index(mboxWithThreeMessages, "From derp.herp")) {
+		t.Errorf("Unexpected offsets %v", offsets)
+	}
+
+	// iteration continues where it was left
+	for item, err := range m.Items() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := item.Message.Header.Get("Subject"); got != "A last test" {
+			t.Errorf("Expected the last message, got %q", got)
+		}
+	}
+}
+
+func TestMessagesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "mbox")
+	if err := ioutil.WriteFile(name, []byte(mboxWithThreeMessages), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for msg, err := range MessagesFile(name, Mboxo) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := msg.Header.Get("Subject"); got != "Test" {
+			t.Errorf("Expected the first message, got %q", got)
+		}
+		break
+	}
+
+	for _, err := range MessagesFile(filepath.Join(dir, "missing"), Mboxo) {
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected a missing file, got %v", err)
+		}
+	}
+}
+
+func TestBabylScannerMessages(t *testing.T) {
+	var subjects []string
+	for msg, err := range NewBabylScanner(strings.NewReader(babylWithTwoMessages)).Messages() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		subjects = append(subjects, msg.Header.Get("Subject"))
+	}
+	if got := strings.Join(subjects, ", "); got != "Reformatted, Unseen" {
+		t.Errorf("Unexpected subjects %q", got)
+	}
+}
@@ -0,0 +1,327 @@
+// Package maildir converts between Maildir directories and the messages read
+// and written by package mbox.
+//
+// Maildir keeps the flags of a message in its file name, while an mbox keeps
+// them in the Status and X-Status header fields. The flags are mapped as
+// follows:
+//
+//	Maildir                  mbox
+//	S (seen)                 Status: R
+//	message in cur/          Status: O
+//	R (replied)              X-Status: A
+//	F (flagged)              X-Status: F
+//	T (trashed)              X-Status: D
+//	D (draft)                X-Status: T
+package maildir
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mzimmerman/mbox"
+	"github.com/mzimmerman/mbox/internal/folder"
+	"github.com/mzimmerman/mbox/internal/mailheader"
+)
+
+// flagMap maps Maildir flags to the flags of the X-Status header field.
+var flagMap = []struct{ maildir, xStatus byte }{
+	{'R', 'A'},
+	{'F', 'F'},
+	{'T', 'D'},
+	{'D', 'T'},
+}
+
+// entry is a message file of a Maildir.
+type entry struct {
+	path  string
+	flags string
+	cur   bool
+	mtime time.Time
+}
+
+// Scanner reads the messages of a Maildir, like mbox.Scanner reads the messages
+// of an mbox. The messages of cur/ and new/ are read in the order they were
+// delivered, according to the modification times of their files.
+type Scanner struct {
+	dir     string
+	entries []entry
+	listed  bool
+	file    *folder.File
+	err     error
+}
+
+// NewScanner returns a new *Scanner to read the Maildir dir.
+func NewScanner(dir string) *Scanner {
+	return &Scanner{dir: dir}
+}
+
+// list collects the message files of the Maildir.
+func (s *Scanner) list() error {
+	for _, sub := range []string{"cur", "new"} {
+		files, err := os.ReadDir(filepath.Join(s.dir, sub))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			info, err := file.Info()
+			if os.IsNotExist(err) {
+				// the message has been moved meanwhile
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			e := entry{path: filepath.Join(s.dir, sub, file.Name()), cur: sub == "cur", mtime: info.ModTime()}
+			if i := strings.Index(file.Name(), ":2,"); i != -1 {
+				e.flags = file.Name()[i+len(":2,"):]
+			}
+			s.entries = append(s.entries, e)
+		}
+	}
+	sort.SliceStable(s.entries, func(i, j int) bool {
+		if !s.entries[i].mtime.Equal(s.entries[j].mtime) {
+			return s.entries[i].mtime.Before(s.entries[j].mtime)
+		}
+		return filepath.Base(s.entries[i].path) < filepath.Base(s.entries[j].path)
+	})
+	return nil
+}
+
+// Next advances the Scanner to the next message, which will then be available
+// through the Message and Envelope methods. It returns false when there are no
+// messages left or an error occurs. After Next returns false, the Err method
+// will return any error that occured.
+//
+// The file of the previous message is closed, so its Body can no longer be
+// read.
+func (s *Scanner) Next() bool {
+	s.close()
+	if s.err != nil {
+		return false
+	}
+	if !s.listed {
+		s.listed = true
+		if s.err = s.list(); s.err != nil {
+			return false
+		}
+	}
+	if len(s.entries) == 0 {
+		return false
+	}
+	e := s.entries[0]
+	s.entries = s.entries[1:]
+
+	if s.file, s.err = folder.Open(e.path); s.err != nil {
+		return false
+	}
+	setStatus(s.file.Message.Header, e.flags, e.cur)
+	return true
+}
+
+// close closes the file of the current message, if any.
+func (s *Scanner) close() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// Close closes the file of the current message.
+func (s *Scanner) Close() error {
+	s.close()
+	return nil
+}
+
+// Err returns the first error that occured while calling Next.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Message returns the current message, with its Maildir flags recorded in the
+// Status and X-Status header fields. Its body is read from the file of the
+// message. Message returns nil if Next has not returned true.
+func (s *Scanner) Message() *mail.Message {
+	if s.err != nil || s.file == nil {
+		return nil
+	}
+	return s.file.Message
+}
+
+// Envelope returns a From_ line for the current message. The sender is taken
+// from the header like for a message written by mbox.Writer, the date is the
+// modification time of the file. Envelope returns nil if Message returns nil.
+func (s *Scanner) Envelope() *mbox.Envelope {
+	if s.err != nil || s.file == nil {
+		return nil
+	}
+	return s.file.Envelope
+}
+
+// setStatus records the Maildir flags in the Status and X-Status fields of h,
+// replacing any present.
+func setStatus(h mail.Header, flags string, cur bool) {
+	delete(h, "Status")
+	delete(h, "X-Status")
+	var status, xStatus string
+	if strings.IndexByte(flags, 'S') != -1 {
+		status += "R"
+	}
+	if cur {
+		status += "O"
+	}
+	for _, f := range flagMap {
+		if strings.IndexByte(flags, f.maildir) != -1 {
+			xStatus += string(f.xStatus)
+		}
+	}
+	if status != "" {
+		h["Status"] = []string{status}
+	}
+	if xStatus != "" {
+		h["X-Status"] = []string{xStatus}
+	}
+}
+
+// flags returns the Maildir flags recorded in the Status and X-Status fields of
+// h, and whether the message belongs to cur/.
+func flags(h mail.Header) (string, bool) {
+	status, xStatus := h.Get("Status"), h.Get("X-Status")
+	var b []byte
+	if strings.IndexByte(status, 'R') != -1 {
+		b = append(b, 'S')
+	}
+	for _, f := range flagMap {
+		if strings.IndexByte(xStatus, f.xStatus) != -1 {
+			b = append(b, f.maildir)
+		}
+	}
+	// flags are sorted by their ASCII value
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	return string(b), len(b) > 0 || strings.IndexByte(status, 'O') != -1
+}
+
+// Writer delivers messages to a Maildir.
+type Writer struct {
+	dir  string
+	host string
+	pid  int
+	seq  int
+	now  func() time.Time
+}
+
+// NewWriter returns a new *Writer delivering messages to the Maildir dir. The
+// directories dir, dir/tmp, dir/new and dir/cur are created if necessary.
+func NewWriter(dir string) (*Writer, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+	return &Writer{dir: dir, host: host, pid: os.Getpid(), now: time.Now}, nil
+}
+
+// uniqueName returns a file name not used by any other delivery.
+func (w *Writer) uniqueName() string {
+	w.seq++
+	t := w.now()
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s", t.Unix(), t.Nanosecond()/1000, w.pid, w.seq, w.host)
+}
+
+// deliver writes a message consisting of header and body to tmp/ and moves it
+// to new/ or cur/. The file is given mtime as its modification time, unless it
+// is the zero time.
+func (w *Writer) deliver(header []byte, body io.Reader, h mail.Header, mtime time.Time) (string, error) {
+	name := w.uniqueName()
+	tmp := filepath.Join(w.dir, "tmp", name)
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(header)
+	if err == nil {
+		_, err = io.Copy(f, body)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	flags, cur := flags(h)
+	path := filepath.Join(w.dir, "new", name)
+	if cur {
+		path = filepath.Join(w.dir, "cur", name+":2,"+flags)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if !mtime.IsZero() {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			return path, err
+		}
+	}
+	return path, nil
+}
+
+// WriteMessage delivers m to the Maildir and returns the path of its file. The
+// Status and X-Status header fields of m are turned into the flags of the file
+// name and not written; the remaining fields are written sorted by name. The
+// modification time of the file is set to the date of env, if it is not nil.
+func (w *Writer) WriteMessage(m *mail.Message, env *mbox.Envelope) (string, error) {
+	h := make(mail.Header, len(m.Header))
+	for name, values := range m.Header {
+		if name != "Status" && name != "X-Status" {
+			h[name] = values
+		}
+	}
+	var header bytes.Buffer
+	if _, err := mailheader.Write(&header, textproto.MIMEHeader(h), nil, "\n"); err != nil {
+		return "", err
+	}
+
+	var mtime time.Time
+	if env != nil {
+		mtime = env.Date
+	}
+	return w.deliver(header.Bytes(), m.Body, m.Header, mtime)
+}
+
+// Import delivers the remaining messages read by s to w, keeping their header
+// fields as found in the mbox, except for Status and X-Status, which are
+// turned into the flags of the file names. The modification time of each file
+// is set to the date of the From_ line of the message. Import returns the
+// number of messages delivered.
+func Import(w *Writer, s *mbox.Scanner) (int, error) {
+	return folder.Import(s, func(header []byte, m *mail.Message, date time.Time) error {
+		_, err := w.deliver(header, m.Body, m.Header, date)
+		return err
+	})
+}
+
+// Export writes the remaining messages read by s to w, with their From_ lines
+// taken from Scanner.Envelope. It returns the number of messages written.
+func Export(w *mbox.Writer, s *Scanner) (int, error) {
+	return folder.Export(w, s)
+}
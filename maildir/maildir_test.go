@@ -0,0 +1,100 @@
+package maildir
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mzimmerman/mbox"
+)
+
+const testMbox = `From herp.derp@example.com  Thu Jan  1 00:00:01 2015
+From: herp.derp@example.com
+Subject: Unread
+X-Mailer: test
+
+New message.
+
+From bernd.lauert@example.com  Fri Jan  2 00:00:01 2015
+Subject: Read
+Status: RO
+X-Status: AF
+From: bernd.lauert@example.com
+
+Read, answered and flagged.
+`
+
+func TestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maildir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := Import(w, mbox.NewScanner(strings.NewReader(testMbox), false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("Expected 2 messages, got %d", n)
+	}
+
+	newFiles, _ := filepath.Glob(filepath.Join(dir, "new", "*"))
+	curFiles, _ := filepath.Glob(filepath.Join(dir, "cur", "*"))
+	tmpFiles, _ := filepath.Glob(filepath.Join(dir, "tmp", "*"))
+	if len(newFiles) != 1 || len(curFiles) != 1 || len(tmpFiles) != 0 {
+		t.Fatalf("Expected a message in new and cur each, got %v %v %v", newFiles, curFiles, tmpFiles)
+	}
+	if !strings.HasSuffix(curFiles[0], ":2,FRS") {
+		t.Errorf("Expected flags FRS, got %s", curFiles[0])
+	}
+	b, err := ioutil.ReadFile(curFiles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Subject: Read\nFrom: bernd.lauert@example.com\n\nRead, answered and flagged.\n"
+	if string(b) != expected {
+		t.Errorf("Expected file %q, got %q", expected, b)
+	}
+	fi, err := os.Stat(newFiles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if date := time.Date(2015, 1, 1, 0, 0, 1, 0, time.UTC); !fi.ModTime().Equal(date) {
+		t.Errorf("Expected modification time %v, got %v", date, fi.ModTime())
+	}
+
+	var out bytes.Buffer
+	mw := mbox.NewWriter(&out)
+	mw.SetLineEnding(mbox.LF)
+	if n, err := Export(mw, NewScanner(dir)); err != nil || n != 2 {
+		t.Fatalf("Expected 2 messages, got %d and error %v", n, err)
+	}
+	expected = `From herp.derp@example.com Thu Jan  1 00:00:01 2015
+From: herp.derp@example.com
+Subject: Unread
+X-Mailer: test
+
+New message.
+
+From bernd.lauert@example.com Fri Jan  2 00:00:01 2015
+From: bernd.lauert@example.com
+Status: RO
+Subject: Read
+X-Status: AF
+
+Read, answered and flagged.
+
+`
+	if out.String() != expected {
+		t.Errorf("Expected mbox:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
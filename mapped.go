@@ -0,0 +1,158 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"net/mail"
+	"os"
+)
+
+// MappedMessage is a message of a MappedMbox. Its slices reference the mapped
+// mbox, so they must not be modified and are only valid until the MappedMbox
+// is closed.
+type MappedMessage struct {
+	// Position is the location of the message within the mbox.
+	Position
+
+	// From is the From_ line, without its line ending. It is nil for MMDF.
+	From []byte
+
+	// Header is the header of the message, including the empty line ending
+	// it.
+	Header []byte
+
+	// Body is the body of the message as found in the mbox, with "From "
+	// lines still escaped.
+	Body []byte
+
+	variant Variant
+}
+
+// Envelope parses the From_ line of m, see ParseEnvelope.
+func (m *MappedMessage) Envelope() (*Envelope, error) {
+	return ParseEnvelope(string(m.From))
+}
+
+// Message parses the header of m and returns it as *mail.Message. Its Body
+// reads from the mapped mbox, except for Mboxrd, whose "From " lines have to be
+// unescaped in a copy.
+func (m *MappedMessage) Message() (*mail.Message, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Header))
+	if err != nil {
+		return nil, err
+	}
+	msg.Body = bytes.NewReader(unescapeMessage(m.Body, m.variant))
+	return msg, nil
+}
+
+// MappedMbox provides random access to the messages of an mbox file mapped
+// into memory. The boundaries of all messages are located when the file is
+// opened, the same way a Scanner finds them. The messages themselves are not
+// copied.
+//
+// Memory mapping is only supported on Linux.
+type MappedMbox struct {
+	data     []byte
+	variant  Variant
+	messages []MappedMessage
+}
+
+// OpenMapped maps the mbox file name into memory and locates its messages,
+// reading it as variant v. If v is Auto, the variant is detected. The file
+// must not be truncated while it is mapped.
+//
+// Like a lenient Scanner, OpenMapped skips malformed data between messages. It
+// returns the error a Scanner reports for the mbox, such as a message at its end
+// whose header cannot be parsed.
+func OpenMapped(name string, v Variant) (*MappedMbox, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if fi.Size() > 0 {
+		if data, err = mmap(f, fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+	if v == Auto {
+		// look at as much of the mbox as a Scanner does
+		sample := data
+		if len(sample) > detectSize {
+			sample = sample[:detectSize]
+		}
+		v = detect(sample, len(data) < detectSize).Variant
+	}
+	messages, err := locateMessages(data, v)
+	if err != nil {
+		if data != nil {
+			munmap(data)
+		}
+		return nil, err
+	}
+	return &MappedMbox{data: data, variant: v, messages: messages}, nil
+}
+
+// locateMessages returns the messages a Scanner finds in data.
+func locateMessages(data []byte, v Variant) ([]MappedMessage, error) {
+	m := NewScanner(bytes.NewReader(data), false)
+	m.SetVariant(v)
+	var messages []MappedMessage
+	for m.Next() {
+		m.body.discard()
+		if m.body.err != io.EOF {
+			return nil, m.body.err
+		}
+		start := int(m.pos.Start)
+		header := start + m.header
+		body := start + len(m.head)
+		end := int(m.body.end)
+		var from []byte
+		if v != MMDF {
+			from = bytes.TrimSuffix(bytes.TrimSuffix(data[start:header], []byte("\n")), []byte("\r"))
+		}
+		messages = append(messages, MappedMessage{
+			Position: m.pos,
+			From:     from[:len(from):len(from)],
+			Header:   data[header:body:body],
+			Body:     data[body:end:end],
+			variant:  v,
+		})
+	}
+	return messages, m.Err()
+}
+
+// Variant returns the variant the mbox is read as.
+func (m *MappedMbox) Variant() Variant {
+	return m.variant
+}
+
+// Len returns the number of messages in m.
+func (m *MappedMbox) Len() int {
+	return len(m.messages)
+}
+
+// Message returns the i-th message of m, counting from 0. It returns
+// ErrMessageNotFound if there is no such message.
+func (m *MappedMbox) Message(i int) (*MappedMessage, error) {
+	if i < 0 || i >= len(m.messages) {
+		return nil, ErrMessageNotFound
+	}
+	return &m.messages[i], nil
+}
+
+// Close unmaps the mbox. The messages of m must not be used afterwards.
+func (m *MappedMbox) Close() error {
+	data := m.data
+	m.data, m.messages = nil, nil
+	if data == nil {
+		return nil
+	}
+	return munmap(data)
+}
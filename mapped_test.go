@@ -0,0 +1,105 @@
+//go:build linux
+
+package mbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenMapped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		variant Variant
+		mbox    string
+	}{
+		{Mboxo, mboxWithThreeMessages},
+		{Mboxo, strings.Replace(mboxWithThreeMessages, "\n", "\r\n", -1)},
+		{Mboxrd, mboxrdWithEscapedFroms},
+		{Mboxcl2, mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody))},
+		{Auto, mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody))},
+		{MMDF, mmdfWithTwoMessages},
+		{Mboxo, ""},
+		{Mboxo, parallelTestMbox(5000)},
+		{Mboxcl2, strings.Repeat(mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody)), 2000)},
+		{Mboxo, "From a@b Thu Jan  1 00:00:01 2015\n\nbody\n\n" + parallelTestMbox(2)},
+		{Mboxo, "From a@b Thu Jan  1 00:00:01 2015\r\n\r\nbody\r\n"},
+		{Mboxo, "From a@b Thu Jan  1 00:00:01 2015\nbroken\n\nbody\n\n" + parallelTestMbox(2)},
+	}
+	for i, test := range tests {
+		name := filepath.Join(dir, fmt.Sprint(i))
+		if err := ioutil.WriteFile(name, []byte(test.mbox), 0600); err != nil {
+			t.Fatal(err)
+		}
+		mm, err := OpenMapped(name, test.variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := NewScanner(strings.NewReader(test.mbox), false)
+		m.SetVariant(test.variant)
+		n := 0
+		for ; m.Next(); n++ {
+			msg, err := mm.Message(n)
+			if err != nil {
+				t.Fatalf("%v: message %d: %v", test.variant, n, err)
+			}
+			body, _ := ioutil.ReadAll(m.Message().Body)
+			if msg.Position != m.Position() {
+				t.Errorf("%v: message %d: Expected position %v, got %v", test.variant, n, m.Position(), msg.Position)
+			}
+			from := ""
+			if m.Envelope() != nil {
+				from = m.Envelope().Raw
+			}
+			if string(msg.From) != from {
+				t.Errorf("%v: message %d: Expected From_ line %q, got %q", test.variant, n, from, msg.From)
+			}
+			parsed, err := msg.Message()
+			if err != nil {
+				t.Fatalf("%v: message %d: %v", test.variant, n, err)
+			}
+			if got := parsed.Header.Get("Subject"); got != m.Message().Header.Get("Subject") {
+				t.Errorf("%v: message %d: Expected subject %q, got %q", test.variant, n, m.Message().Header.Get("Subject"), got)
+			}
+			if got, _ := ioutil.ReadAll(parsed.Body); string(got) != string(body) {
+				t.Errorf("%v: message %d: Expected body %q, got %q", test.variant, n, body, got)
+			}
+		}
+		if mm.Len() != n {
+			t.Errorf("%v: Expected %d messages, got %d", test.variant, n, mm.Len())
+		}
+		if _, err := mm.Message(n); err != ErrMessageNotFound {
+			t.Errorf("%v: Expected %v, got %v", test.variant, ErrMessageNotFound, err)
+		}
+		if err := mm.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestOpenMappedBrokenTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "mbox")
+	mbox := "From a@b Thu Jan  1 00:00:01 2015\nbroken\n\nbody\n"
+	if err := ioutil.WriteFile(name, []byte(mbox), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenMapped(name, Mboxo); err == nil {
+		t.Error("Expected an error for a message at the end whose header cannot be parsed")
+	}
+}
@@ -0,0 +1,472 @@
+// Package mh reads and writes MH folders, converting to and from the messages
+// read and written by package mbox.
+//
+// An MH folder is a directory holding every message in a file named by its
+// number. Sequences, named sets of messages like "unseen", are kept in the
+// file .mh_sequences, one per line:
+//
+//	unseen: 3-5 8
+//	flagged: 1 4
+package mh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mzimmerman/mbox"
+	"github.com/mzimmerman/mbox/internal/folder"
+	"github.com/mzimmerman/mbox/internal/mailheader"
+)
+
+// sequencesFile is the name of the file holding the sequences of a folder.
+const sequencesFile = ".mh_sequences"
+
+// span is a run of message numbers from lo to hi, inclusive.
+type span struct{ lo, hi int }
+
+// sequence is a set of message numbers, kept as the runs of consecutive
+// numbers in ascending order, so a sequence like "1-2000000000" takes no more
+// memory than it takes room in the sequences file.
+type sequence []span
+
+// contains reports whether n belongs to q.
+func (q sequence) contains(n int) bool {
+	i := sort.Search(len(q), func(i int) bool { return q[i].hi >= n })
+	return i < len(q) && q[i].lo <= n
+}
+
+// add returns q with the numbers of spans added.
+func (q sequence) add(spans ...span) sequence {
+	q = append(q, spans...)
+	sort.Slice(q, func(i, j int) bool { return q[i].lo < q[j].lo })
+	out := q[:0]
+	for _, r := range q {
+		if k := len(out); k > 0 && r.lo-1 <= out[k-1].hi {
+			// r overlaps or continues the last run
+			if r.hi > out[k-1].hi {
+				out[k-1].hi = r.hi
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// sequenceMap maps the names of sequences to their messages.
+type sequenceMap map[string]sequence
+
+// readSequences reads the sequences of the folder dir. A missing file holds no
+// sequences.
+func readSequences(dir string) (sequenceMap, error) {
+	f, err := os.Open(filepath.Join(dir, sequencesFile))
+	if os.IsNotExist(err) {
+		return sequenceMap{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seqs := sequenceMap{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		i := strings.IndexByte(s.Text(), ':')
+		if i == -1 {
+			continue
+		}
+		name := strings.TrimSpace(s.Text()[:i])
+		var spans []span
+		for _, r := range strings.Fields(s.Text()[i+1:]) {
+			first, last := r, r
+			if j := strings.IndexByte(r, '-'); j != -1 {
+				first, last = r[:j], r[j+1:]
+			}
+			lo, err := strconv.Atoi(first)
+			if err != nil || lo <= 0 {
+				return nil, fmt.Errorf("mh: invalid sequence %s: %q", name, r)
+			}
+			hi, err := strconv.Atoi(last)
+			if err != nil || hi < lo {
+				return nil, fmt.Errorf("mh: invalid sequence %s: %q", name, r)
+			}
+			spans = append(spans, span{lo, hi})
+		}
+		seqs[name] = seqs[name].add(spans...)
+	}
+	return seqs, s.Err()
+}
+
+// format returns the line of the sequence name holding the messages of q.
+func format(name string, q sequence) string {
+	b := &strings.Builder{}
+	b.WriteString(name + ":")
+	for _, r := range q {
+		if r.hi > r.lo {
+			fmt.Fprintf(b, " %d-%d", r.lo, r.hi)
+		} else {
+			fmt.Fprintf(b, " %d", r.lo)
+		}
+	}
+	return b.String() + "\n"
+}
+
+// writeSequences replaces the sequences of the folder dir with seqs. Empty
+// sequences are left out.
+func writeSequences(dir string, seqs sequenceMap) error {
+	names := make([]string, 0, len(seqs))
+	for name, q := range seqs {
+		if len(q) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	for _, name := range names {
+		b.WriteString(format(name, seqs[name]))
+	}
+
+	f, err := ioutil.TempFile(dir, ",mh_sequences")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(dir, sequencesFile))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// messageNumbers returns the numbers of the messages of the folder dir in
+// ascending order.
+func messageNumbers(dir string) ([]int, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var numbers []int
+	for _, file := range files {
+		n, err := strconv.Atoi(file.Name())
+		if err != nil || n <= 0 || file.IsDir() || strconv.Itoa(n) != file.Name() {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+// Scanner reads the messages of an MH folder in numeric order, like
+// mbox.Scanner reads the messages of an mbox.
+type Scanner struct {
+	dir     string
+	numbers []int
+	seqs    sequenceMap
+	listed  bool
+	n       int
+	file    *folder.File
+	err     error
+}
+
+// NewScanner returns a new *Scanner to read the MH folder dir.
+func NewScanner(dir string) *Scanner {
+	return &Scanner{dir: dir}
+}
+
+// Next advances the Scanner to the next message, which will then be available
+// through the Message, Envelope, Number and Sequences methods. It returns false
+// when there are no messages left or an error occurs. After Next returns false,
+// the Err method will return any error that occured.
+//
+// The file of the previous message is closed, so its Body can no longer be
+// read.
+func (s *Scanner) Next() bool {
+	s.close()
+	s.n = 0
+	if s.err != nil {
+		return false
+	}
+	if !s.listed {
+		s.listed = true
+		if s.numbers, s.err = messageNumbers(s.dir); s.err != nil {
+			return false
+		}
+		if s.seqs, s.err = readSequences(s.dir); s.err != nil {
+			return false
+		}
+	}
+
+	for len(s.numbers) > 0 {
+		n := s.numbers[0]
+		s.numbers = s.numbers[1:]
+		file, err := folder.Open(filepath.Join(s.dir, strconv.Itoa(n)))
+		if os.IsNotExist(err) {
+			// the message has been removed meanwhile
+			continue
+		}
+		if err != nil {
+			s.err = err
+			return false
+		}
+		s.file, s.n = file, n
+		setStatus(file.Message.Header, s.seqs["unseen"].contains(n), s.seqs["flagged"].contains(n))
+		return true
+	}
+	return false
+}
+
+// close closes the file of the current message, if any.
+func (s *Scanner) close() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// Close closes the file of the current message.
+func (s *Scanner) Close() error {
+	s.close()
+	return nil
+}
+
+// Err returns the first error that occured while calling Next.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Message returns the current message, with its sequences unseen and flagged
+// recorded in the Status and X-Status header fields. Its body is read from the
+// file of the message. Message returns nil if Next has not returned true.
+func (s *Scanner) Message() *mail.Message {
+	if s.err != nil || s.file == nil {
+		return nil
+	}
+	return s.file.Message
+}
+
+// Envelope returns a From_ line for the current message. The sender is taken
+// from the header like for a message written by mbox.Writer, the date is the
+// modification time of the file. Envelope returns nil if Message returns nil.
+func (s *Scanner) Envelope() *mbox.Envelope {
+	if s.err != nil || s.file == nil {
+		return nil
+	}
+	return s.file.Envelope
+}
+
+// Number returns the number of the current message, or 0 if Message returns
+// nil.
+func (s *Scanner) Number() int {
+	if s.err != nil || s.file == nil {
+		return 0
+	}
+	return s.n
+}
+
+// Sequences returns the names of the sequences the current message belongs to,
+// sorted by name.
+func (s *Scanner) Sequences() []string {
+	if s.err != nil || s.file == nil {
+		return nil
+	}
+	var names []string
+	for name, q := range s.seqs {
+		if q.contains(s.n) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Writer appends messages to an MH folder. It numbers them on from the highest
+// number in use when it writes its first message, skipping numbers taken by
+// others meanwhile.
+type Writer struct {
+	dir  string
+	next int // number to try for the next message, 0 until it is known
+}
+
+// NewWriter returns a new *Writer appending messages to the MH folder dir,
+// which is created if necessary.
+func NewWriter(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Writer{dir: dir}, nil
+}
+
+// deliver writes a message consisting of header and body to the folder under
+// the next free number and returns its number. The file is given mtime as its
+// modification time, unless it is the zero time.
+func (w *Writer) deliver(header []byte, body io.Reader, mtime time.Time) (int, error) {
+	// The message is written to a temporary file first, which is then
+	// linked to the next free number. Linking fails if the number has been
+	// taken meanwhile.
+	f, err := ioutil.TempFile(w.dir, ",mh")
+	if err != nil {
+		return 0, err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.Write(header)
+	if err == nil {
+		_, err = io.Copy(f, body)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !mtime.IsZero() {
+		if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.next == 0 {
+		numbers, err := messageNumbers(w.dir)
+		if err != nil {
+			return 0, err
+		}
+		w.next = 1
+		if len(numbers) > 0 {
+			w.next = numbers[len(numbers)-1] + 1
+		}
+	}
+	for {
+		err := os.Link(tmp, filepath.Join(w.dir, strconv.Itoa(w.next)))
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return 0, err
+		}
+		w.next++
+	}
+	n := w.next
+	w.next++
+	return n, nil
+}
+
+// addSequences adds the messages of added to the sequences of the folder.
+func (w *Writer) addSequences(added sequenceMap) error {
+	if len(added) == 0 {
+		return nil
+	}
+	seqs, err := readSequences(w.dir)
+	if err != nil {
+		return err
+	}
+	for name, q := range added {
+		seqs[name] = seqs[name].add(q...)
+	}
+	return writeSequences(w.dir, seqs)
+}
+
+// WriteMessage appends m to the folder, adds it to the sequences named and
+// returns its number. The header fields of m are written sorted by name. The
+// modification time of the file is set to the date of env, if it is not nil.
+func (w *Writer) WriteMessage(m *mail.Message, env *mbox.Envelope, sequences ...string) (int, error) {
+	var header bytes.Buffer
+	if _, err := mailheader.Write(&header, textproto.MIMEHeader(m.Header), nil, "\n"); err != nil {
+		return 0, err
+	}
+
+	var mtime time.Time
+	if env != nil {
+		mtime = env.Date
+	}
+	n, err := w.deliver(header.Bytes(), m.Body, mtime)
+	if err != nil {
+		return 0, err
+	}
+	added := sequenceMap{}
+	for _, name := range sequences {
+		added[name] = sequence{{n, n}}
+	}
+	return n, w.addSequences(added)
+}
+
+// setStatus records the sequences unseen and flagged of a message in the
+// Status and X-Status fields of h, replacing any present, the reverse of
+// statusSequences: Status is RO unless the message is unseen, and X-Status is F
+// if it is flagged.
+func setStatus(h mail.Header, unseen, flagged bool) {
+	delete(h, "Status")
+	delete(h, "X-Status")
+	if !unseen {
+		h["Status"] = []string{"RO"}
+	}
+	if flagged {
+		h["X-Status"] = []string{"F"}
+	}
+}
+
+// statusSequences returns the sequences recorded in the Status and X-Status
+// fields of h: unseen unless Status contains R, and flagged if X-Status
+// contains F.
+func statusSequences(h mail.Header) []string {
+	var seqs []string
+	if !strings.ContainsRune(h.Get("Status"), 'R') {
+		seqs = append(seqs, "unseen")
+	}
+	if strings.ContainsRune(h.Get("X-Status"), 'F') {
+		seqs = append(seqs, "flagged")
+	}
+	return seqs
+}
+
+// Import appends the remaining messages read by s to w, keeping their header
+// fields as found in the mbox, except for Status and X-Status, which are turned
+// into the sequences unseen and flagged. The modification time of each file is
+// set to the date of the From_ line of the message. Import returns the number
+// of messages appended.
+func Import(w *Writer, s *mbox.Scanner) (int, error) {
+	added := sequenceMap{}
+	n, err := folder.Import(s, func(header []byte, m *mail.Message, date time.Time) error {
+		number, err := w.deliver(header, m.Body, date)
+		if err != nil {
+			return err
+		}
+		for _, name := range statusSequences(m.Header) {
+			added[name] = append(added[name], span{number, number})
+		}
+		return nil
+	})
+	// the sequences are written once, including those of the messages
+	// appended before an error occured
+	if serr := w.addSequences(added); err == nil {
+		err = serr
+	}
+	return n, err
+}
+
+// Export writes the remaining messages read by s to w, with their From_ lines
+// taken from Scanner.Envelope and their sequences unseen and flagged turned
+// back into Status and X-Status, see Scanner.Message. It returns the number of
+// messages written.
+func Export(w *mbox.Writer, s *Scanner) (int, error) {
+	return folder.Export(w, s)
+}
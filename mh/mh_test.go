@@ -0,0 +1,205 @@
+package mh
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mzimmerman/mbox"
+)
+
+const testMbox = `From herp.derp@example.com  Thu Jan  1 00:00:01 2015
+From: herp.derp@example.com
+Subject: Unread
+
+New message.
+
+From bernd.lauert@example.com  Fri Jan  2 00:00:01 2015
+Subject: Read
+Status: RO
+X-Status: F
+From: bernd.lauert@example.com
+
+Read and flagged.
+`
+
+func TestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := Import(w, mbox.NewScanner(strings.NewReader(testMbox), false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("Expected 2 messages, got %d", n)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Subject: Read\nFrom: bernd.lauert@example.com\n\nRead and flagged.\n"; string(b) != expected {
+		t.Errorf("Expected file %q, got %q", expected, b)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if date := time.Date(2015, 1, 1, 0, 0, 1, 0, time.UTC); !fi.ModTime().Equal(date) {
+		t.Errorf("Expected modification time %v, got %v", date, fi.ModTime())
+	}
+
+	// the numbers of a new Writer continue after the highest one in use
+	if err := ioutil.WriteFile(filepath.Join(dir, "4"), []byte("Subject: Four\n\nFour.\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if w, err = NewWriter(dir); err != nil {
+		t.Fatal(err)
+	}
+	msg := &mail.Message{
+		Header: mail.Header{"From": {"herp.derp@example.com"}, "Subject": {"Written"}},
+		Body:   strings.NewReader("Written.\n"),
+	}
+	if n, err := w.WriteMessage(msg, nil, "unseen"); err != nil || n != 5 {
+		t.Fatalf("Expected message 5, got %d and error %v", n, err)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, sequencesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "flagged: 2\nunseen: 1 5\n"; string(b) != expected {
+		t.Errorf("Expected sequences %q, got %q", expected, b)
+	}
+
+	var got []string
+	s := NewScanner(dir)
+	for s.Next() {
+		got = append(got, s.Message().Header.Get("Subject")+" "+strings.Join(s.Sequences(), ","))
+	}
+	if s.Err() != nil {
+		t.Fatal(s.Err())
+	}
+	if expected := "Unread unseen|Read flagged|Four |Written unseen"; strings.Join(got, "|") != expected {
+		t.Errorf("Expected messages %q, got %q", expected, strings.Join(got, "|"))
+	}
+
+	var out bytes.Buffer
+	if n, err := Export(mbox.NewWriter(&out), NewScanner(dir)); err != nil || n != 4 {
+		t.Fatalf("Expected 4 messages, got %d and error %v", n, err)
+	}
+	if !strings.HasPrefix(out.String(), "From herp.derp@example.com Thu Jan  1 00:00:01 2015\r\n") {
+		t.Errorf("Expected the date of the file in the From_ line, got %q", out.String())
+	}
+
+	// the sequences are turned back into Status and X-Status
+	got = nil
+	m := mbox.NewScanner(&out, false)
+	for m.Next() {
+		h := m.Message().Header
+		got = append(got, h.Get("Subject")+" "+h.Get("Status")+" "+h.Get("X-Status"))
+	}
+	if m.Err() != nil {
+		t.Fatal(m.Err())
+	}
+	if expected := "Unread  |Read RO F|Four RO |Written  "; strings.Join(got, "|") != expected {
+		t.Errorf("Expected messages %q, got %q", expected, strings.Join(got, "|"))
+	}
+}
+
+func TestWriterNumbers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for i := 0; i < 300; i++ {
+		status := "RO"
+		if i%3 == 0 {
+			status = "O"
+		}
+		fmt.Fprintf(&b, "From herp.derp@example.com  Thu Jan  1 00:00:01 2015\nSubject: %d\nStatus: %s\n\nBody.\n\n", i, status)
+	}
+	if n, err := Import(w, mbox.NewScanner(strings.NewReader(b.String()), false)); err != nil || n != 300 {
+		t.Fatalf("Expected 300 messages, got %d and error %v", n, err)
+	}
+	seqs, err := readSequences(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seqs["unseen"]) != 100 || !seqs["unseen"].contains(298) || seqs["unseen"].contains(299) {
+		t.Errorf("Unexpected unseen sequence %v", seqs["unseen"])
+	}
+
+	// a number taken meanwhile is skipped
+	if err := ioutil.WriteFile(filepath.Join(dir, "301"), []byte("Subject: Taken\n\nTaken.\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	msg := &mail.Message{Header: mail.Header{"Subject": {"Written"}}, Body: strings.NewReader("Written.\n")}
+	if n, err := w.WriteMessage(msg, nil); err != nil || n != 302 {
+		t.Fatalf("Expected message 302, got %d and error %v", n, err)
+	}
+}
+
+func TestSequencesFormat(t *testing.T) {
+	for _, test := range []struct {
+		spans    []span
+		expected string
+	}{
+		{[]span{{1, 1}}, "unseen: 1\n"},
+		{[]span{{7, 8}, {1, 1}, {5, 5}, {2, 3}}, "unseen: 1-3 5 7-8\n"},
+		{[]span{{1, 5}, {3, 9}, {10, 10}}, "unseen: 1-10\n"},
+	} {
+		if got := format("unseen", sequence(nil).add(test.spans...)); got != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, got)
+		}
+	}
+}
+
+func TestReadSequences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const sequences = "flagged: 3 1\nunseen: 1-2000000000\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, sequencesFile), []byte(sequences), 0600); err != nil {
+		t.Fatal(err)
+	}
+	seqs, err := readSequences(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seqs["unseen"].contains(1999999999) || seqs["unseen"].contains(2000000001) || seqs["flagged"].contains(2) {
+		t.Errorf("Unexpected sequences %v", seqs)
+	}
+	if err := writeSequences(dir, seqs); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, sequencesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "flagged: 1 3\nunseen: 1-2000000000\n"; string(b) != expected {
+		t.Errorf("Expected sequences %q, got %q", expected, b)
+	}
+}
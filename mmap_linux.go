@@ -0,0 +1,21 @@
+//go:build linux
+
+package mbox
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of f into memory for reading.
+func mmap(f *os.File, size int64) ([]byte, error) {
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	return data, nil
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
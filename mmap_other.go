@@ -0,0 +1,17 @@
+//go:build !linux
+
+package mbox
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap maps the first size bytes of f into memory for reading.
+func mmap(f *os.File, size int64) ([]byte, error) {
+	return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: errors.New("memory mapping is not supported on this platform")}
+}
+
+func munmap(data []byte) error {
+	return nil
+}
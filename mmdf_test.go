@@ -0,0 +1,142 @@
+package mbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+const mmdfWithTwoMessages = "\x01\x01\x01\x01\n" +
+	"From: herp.derp@example.com\nSubject: First\n\n" +
+	"From the start.\n\n" +
+	"\x01\x01\x01\x01\n" +
+	"junk\n" +
+	"\x01\x01\x01\x01\n" +
+	"From: bernd.lauert@example.com\nSubject: Second\n\n" +
+	"Second body.\n" +
+	"\x01\x01\x01\x01\n"
+
+func TestScannerMMDF(t *testing.T) {
+	for _, v := range []Variant{MMDF, Auto} {
+		m := NewScanner(strings.NewReader(mmdfWithTwoMessages), false)
+		m.SetVariant(v)
+		var got []string
+		for m.Next() {
+			if m.Envelope() != nil {
+				t.Errorf("Expected no envelope, got %v", m.Envelope())
+			}
+			b, err := ioutil.ReadAll(m.Message().Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pos := m.Position()
+			raw := mmdfWithTwoMessages[pos.Start:pos.End]
+			if !strings.HasPrefix(raw, "\x01\x01\x01\x01\n") || !strings.HasSuffix(raw, "\x01\x01\x01\x01\n") {
+				t.Errorf("Expected the position to span the delimiters, got %q", raw)
+			}
+			got = append(got, m.Message().Header.Get("Subject")+": "+string(b))
+		}
+		if m.Err() != nil {
+			t.Fatal(m.Err())
+		}
+		if m.Variant() != MMDF {
+			t.Errorf("Expected variant %v, got %v", MMDF, m.Variant())
+		}
+		expected := "First: From the start.\n\n|Second: Second body.\n"
+		if s := strings.Join(got, "|"); s != expected {
+			t.Errorf("%v: Expected messages %q, got %q", v, expected, s)
+		}
+	}
+
+	truncated := strings.Replace(mmdfWithTwoMessages, "junk\n", "", 1)
+	truncated = truncated[:len(truncated)-len("\x01\x01\x01\x01\n")]
+	m := NewScanner(strings.NewReader(truncated), false)
+	m.SetVariant(MMDF)
+	m.SetStrict(true)
+	for m.Next() {
+	}
+	if pe, ok := m.Err().(*ParseError); !ok || pe.Reason != TruncatedMessage {
+		t.Errorf("Expected a truncated message, got %v", m.Err())
+	}
+}
+
+func TestWriterMMDF(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := NewWriter(b)
+	w.SetVariant(MMDF)
+	w.SetLineEnding(LF)
+	msg := &mail.Message{
+		Header: mail.Header{"From": {"herp.derp@example.com"}, "Subject": {"Test"}},
+		Body:   strings.NewReader("From the start.\nNo line ending"),
+	}
+	if _, err := w.WriteMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	expected := "\x01\x01\x01\x01\nFrom: herp.derp@example.com\nSubject: Test\n\n" +
+		"From the start.\nNo line ending\n\x01\x01\x01\x01\n"
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+
+	// a delimiter line in the body does not end the message
+	b.Reset()
+	msg.Body = strings.NewReader("First line.\n\x01\x01\x01\x01\nLast line.\n")
+	if _, err := w.WriteMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteRaw([]byte("Subject: Raw\n\n\x01\x01\x01\x01\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	m := NewScanner(bytes.NewReader(b.Bytes()), false)
+	m.SetVariant(MMDF)
+	m.SetStrict(true)
+	for m.Next() {
+		body, err := ioutil.ReadAll(m.Message().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, string(body))
+	}
+	if m.Err() != nil {
+		t.Fatal(m.Err())
+	}
+	if expected := "First line.\n>\x01\x01\x01\x01\nLast line.\n|>\x01\x01\x01\x01\n"; strings.Join(bodies, "|") != expected {
+		t.Errorf("Expected bodies %q, got %q", expected, strings.Join(bodies, "|"))
+	}
+
+	// an MMDF mailbox is reproduced by WriteRaw
+	b.Reset()
+	m = NewScanner(strings.NewReader(mmdfWithTwoMessages), false)
+	m.SetVariant(MMDF)
+	for m.Next() {
+		body, err := ioutil.ReadAll(m.Message().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.WriteRaw(append(m.RawHeader(), body...), m.Envelope()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected = strings.Replace(mmdfWithTwoMessages, "junk\n", "", 1)
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
+
+func TestReverseScannerMMDF(t *testing.T) {
+	m := NewReverseScanner(strings.NewReader(mmdfWithTwoMessages), int64(len(mmdfWithTwoMessages)))
+	m.SetVariant(Auto)
+	var subjects []string
+	for m.Next() {
+		subjects = append(subjects, m.Message().Header.Get("Subject"))
+	}
+	if m.Err() != nil {
+		t.Fatal(m.Err())
+	}
+	if s := strings.Join(subjects, ","); s != "Second,First" {
+		t.Errorf("Expected subjects %q, got %q", "Second,First", s)
+	}
+}
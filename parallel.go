@@ -0,0 +1,335 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/mail"
+	"runtime"
+	"sync"
+)
+
+// defaultChunkSize is the default size of the chunks a ParallelScanner splits
+// an mbox into.
+const defaultChunkSize = 16 << 20
+
+// ParsedMessage is a message read by a ParallelScanner or a Follower.
+type ParsedMessage struct {
+	// Position is the location of the message within the mbox.
+	Position
+
+	Envelope *Envelope
+
+	// Message is the message read. Its Body is read from memory.
+	Message *mail.Message
+}
+
+// ParallelScanner reads the messages of an mbox provided by an io.ReaderAt
+// using several goroutines. The mbox is split into chunks at From_ lines that
+// start a message according to the same rules a Scanner follows, and the chunks
+// are parsed concurrently.
+//
+// Bodies delimited by a Content-Length header may contain unescaped From_
+// lines, so mboxes of the variants Mboxcl and Mboxcl2 are read as a single
+// chunk, as are MMDF mailboxes.
+type ParallelScanner struct {
+	r         io.ReaderAt
+	size      int64
+	variant   Variant
+	workers   int
+	chunkSize int64
+	ordered   bool
+}
+
+// NewParallelScanner returns a new *ParallelScanner to read the size bytes of
+// mbox data provided by r. r must be safe for concurrent use, like *os.File.
+func NewParallelScanner(r io.ReaderAt, size int64) *ParallelScanner {
+	return &ParallelScanner{
+		r:         r,
+		size:      size,
+		workers:   runtime.GOMAXPROCS(0),
+		chunkSize: defaultChunkSize,
+		ordered:   true,
+	}
+}
+
+// SetVariant sets the mbox variant, see Scanner.SetVariant. The default is
+// Mboxo.
+func (p *ParallelScanner) SetVariant(v Variant) {
+	p.variant = v
+}
+
+// SetWorkers sets the number of goroutines parsing messages. The default is
+// GOMAXPROCS.
+func (p *ParallelScanner) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.workers = n
+}
+
+// SetChunkSize sets the approximate size of the chunks the mbox is split into.
+// The default is 16 MiB. Smaller chunks spread the work more evenly, but each
+// chunk has to be resynchronized on a From_ line.
+func (p *ParallelScanner) SetChunkSize(n int64) {
+	if n < 1 {
+		n = 1
+	}
+	p.chunkSize = n
+}
+
+// SetOrdered sets whether messages are delivered in the order they appear in
+// the mbox. The default is true. Unordered delivery does not have to wait for
+// earlier chunks and so makes better use of the workers.
+func (p *ParallelScanner) SetOrdered(ordered bool) {
+	p.ordered = ordered
+}
+
+// separatorAt reports whether the line starting at off is a From_ line
+// followed by a header of at least two fields, looking at most as far ahead as
+// a Scanner with the default buffer size does. from reports whether the line is
+// a From_ line, regardless of its header.
+func separatorAt(r io.ReaderAt, off, size int64) (from, ok bool, err error) {
+	buf := make([]byte, bufio.MaxScanTokenSize)
+	if int64(len(buf)) > size-off {
+		buf = buf[:size-off]
+	}
+	n, err := r.ReadAt(buf, off)
+	if err != nil && err != io.EOF {
+		return false, false, err
+	}
+	data := buf[:n]
+	e := bytes.IndexByte(data, '\n')
+	if e == -1 || !isFromLine(data[:e]) {
+		return false, false, nil
+	}
+	ok, _ = validHeader(data[e+1:], true)
+	return true, ok, nil
+}
+
+// nextSeparator returns the offset of the first From_ line starting a message
+// at or after off, or size if there is none.
+func nextSeparator(r io.ReaderAt, off, size int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+	pattern := []byte("\nFrom ")
+	buf := make([]byte, 64*1024)
+	// start with the line ending preceding off, if any
+	for base := off - 1; base+int64(len(pattern)) <= size; {
+		if int64(len(buf)) > size-base {
+			buf = buf[:size-base]
+		}
+		n, err := r.ReadAt(buf, base)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		data := buf[:n]
+		for pos := 0; ; {
+			i := bytes.Index(data[pos:], pattern)
+			if i == -1 {
+				break
+			}
+			start := base + int64(pos+i+1)
+			_, ok, err := separatorAt(r, start, size)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return start, nil
+			}
+			pos += i + 1
+		}
+		if n < len(pattern) {
+			break
+		}
+		// the pattern may span the end of the data read
+		base += int64(n - len(pattern) + 1)
+	}
+	return size, nil
+}
+
+// chunk is a part of the mbox parsed by a single worker.
+type chunk struct {
+	start, end int64
+	messages   chan ParsedMessage
+	err        error
+}
+
+// chunks splits the mbox into chunks starting with a From_ line.
+func (p *ParallelScanner) chunks(v Variant) ([]*chunk, error) {
+	starts := []int64{0}
+	for off := p.chunkSize; off < p.size && !v.contentLength() && v != MMDF; {
+		start, err := nextSeparator(p.r, off, p.size)
+		if err != nil {
+			return nil, err
+		}
+		if start == p.size {
+			break
+		}
+		starts = append(starts, start)
+		off = start + p.chunkSize
+	}
+
+	chunks := make([]*chunk, len(starts))
+	for i, start := range starts {
+		end := p.size
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		chunks[i] = &chunk{start: start, end: end}
+	}
+	return chunks, nil
+}
+
+// parse reads the messages of c and sends them to out, until ctx is done.
+//
+// The Scanner reads on into the next chunk as far as it looks ahead, so that
+// the last message of c ends at the From_ line starting the next chunk just
+// like it does for a Scanner reading the whole mbox.
+func (p *ParallelScanner) parse(ctx context.Context, c *chunk, v Variant, out chan<- ParsedMessage) error {
+	end := c.end + bufio.MaxScanTokenSize
+	if end > p.size {
+		end = p.size
+	}
+	m := NewScanner(io.NewSectionReader(p.r, c.start, end-c.start), false)
+	m.SetVariant(v)
+	for m.NextContext(ctx) {
+		if c.start+m.Position().Start >= c.end {
+			// the first message of the next chunk
+			return nil
+		}
+		msg := m.Message()
+		if err := readBody(msg); err != nil {
+			return err
+		}
+		pos := m.Position()
+		pos.Start += c.start
+		pos.End += c.start
+		select {
+		case out <- ParsedMessage{Position: pos, Envelope: m.Envelope(), Message: msg}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if m.Err() != nil && c.start+m.pos.Start >= c.end {
+		// the next chunk reads the message failing
+		return nil
+	}
+	return m.Err()
+}
+
+// Scan reads all messages of the mbox and calls f for each of them, one at a
+// time. It stops at the first error, which is returned, including an error
+// returned by f or the error of ctx once it is done.
+func (p *ParallelScanner) Scan(ctx context.Context, f func(ParsedMessage) error) error {
+	v := p.variant
+	if v == Auto {
+		d, err := DetectAt(io.NewSectionReader(p.r, 0, p.size))
+		if err != nil {
+			return err
+		}
+		v = d.Variant
+	}
+	chunks, err := p.chunks(v)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// In order, each chunk delivers its messages through a channel of its
+	// own, which is read once all previous chunks have been delivered.
+	unordered := make(chan ParsedMessage, 64)
+	for _, c := range chunks {
+		if p.ordered {
+			c.messages = make(chan ParsedMessage, 64)
+		} else {
+			c.messages = unordered
+		}
+	}
+
+	// the first error stops all workers, which then fail with the error of
+	// ctx
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	fail := func(err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		return firstErr
+	}
+
+	jobs := make(chan *chunk)
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers && i < len(chunks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				c.err = p.parse(ctx, c, v, c.messages)
+				if c.err != nil {
+					c.err = fail(c.err)
+				}
+				if p.ordered {
+					close(c.messages)
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i, c := range chunks {
+			select {
+			case jobs <- c:
+			case <-ctx.Done():
+				if p.ordered {
+					for _, c := range chunks[i:] {
+						close(c.messages)
+					}
+				}
+				return
+			}
+		}
+	}()
+	if !p.ordered {
+		go func() {
+			wg.Wait()
+			close(unordered)
+		}()
+	}
+	// stop the workers before returning
+	defer wg.Wait()
+
+	if p.ordered {
+		for _, c := range chunks {
+			for msg := range c.messages {
+				if err := f(msg); err != nil {
+					return fail(err)
+				}
+			}
+			if c.err != nil {
+				return c.err
+			}
+		}
+	} else {
+		for msg := range unordered {
+			if err := f(msg); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,185 @@
+package mbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// parallelTestMbox returns an mbox of n messages, whose bodies contain From_
+// lines that do not start a message.
+func parallelTestMbox(n int) string {
+	b := &strings.Builder{}
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(b, "From herp.derp@example.com  Thu Jan  1 00:00:01 2015\n"+
+			"From: herp.derp@example.com\nSubject: %d\n\n"+
+			"Message %d.\n\nFrom nobody  Thu Jan  1 00:00:01 2015\nnot a header\n%s\n\n",
+			i, i, strings.Repeat("x", i%97))
+	}
+	return b.String()
+}
+
+// sequentialMessages returns the messages of mbox read by a Scanner.
+func sequentialMessages(t *testing.T, mbox string, v Variant) []string {
+	var messages []string
+	m := NewScanner(strings.NewReader(mbox), false)
+	m.SetVariant(v)
+	for m.Next() {
+		b, err := ioutil.ReadAll(m.Message().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, fmt.Sprintf("%d-%d %s %q", m.Position().Start, m.Position().End, m.Message().Header.Get("Subject"), b))
+	}
+	if m.Err() != nil {
+		t.Fatal(m.Err())
+	}
+	return messages
+}
+
+func TestParallelScanner(t *testing.T) {
+	mbox := parallelTestMbox(500)
+	expected := sequentialMessages(t, mbox, Mboxo)
+	if len(expected) != 500 {
+		t.Fatalf("Expected 500 messages, got %d", len(expected))
+	}
+
+	for _, ordered := range []bool{true, false} {
+		p := NewParallelScanner(strings.NewReader(mbox), int64(len(mbox)))
+		p.SetWorkers(4)
+		p.SetChunkSize(1000)
+		p.SetOrdered(ordered)
+		var got []string
+		err := p.Scan(context.Background(), func(msg ParsedMessage) error {
+			b, err := ioutil.ReadAll(msg.Message.Body)
+			if err != nil {
+				return err
+			}
+			got = append(got, fmt.Sprintf("%d-%d %s %q", msg.Start, msg.End, msg.Message.Header.Get("Subject"), b))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ordered {
+			sort.Slice(got, func(i, j int) bool {
+				var a, b int
+				fmt.Sscanf(got[i], "%d", &a)
+				fmt.Sscanf(got[j], "%d", &b)
+				return a < b
+			})
+		}
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("ordered %v: messages differ from Scanner, got %d messages", ordered, len(got))
+		}
+	}
+}
+
+func TestParallelScannerContentLength(t *testing.T) {
+	mbox := strings.Repeat(mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody)), 20)
+	expected := sequentialMessages(t, mbox, Mboxcl2)
+	p := NewParallelScanner(strings.NewReader(mbox), int64(len(mbox)))
+	p.SetVariant(Auto)
+	p.SetChunkSize(100)
+	n := 0
+	if err := p.Scan(context.Background(), func(msg ParsedMessage) error {
+		n++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n != len(expected) {
+		t.Errorf("Expected %d messages, got %d", len(expected), n)
+	}
+}
+
+func TestParallelScannerStop(t *testing.T) {
+	mbox := parallelTestMbox(200)
+	stop := errors.New("stop")
+	for _, ordered := range []bool{true, false} {
+		p := NewParallelScanner(strings.NewReader(mbox), int64(len(mbox)))
+		p.SetChunkSize(500)
+		p.SetOrdered(ordered)
+		n := 0
+		err := p.Scan(context.Background(), func(msg ParsedMessage) error {
+			n++
+			if n == 10 {
+				return stop
+			}
+			return nil
+		})
+		if err != stop || n != 10 {
+			t.Errorf("ordered %v: Expected to stop after 10 messages, got %d messages and error %v", ordered, n, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := NewParallelScanner(strings.NewReader(mbox), int64(len(mbox)))
+	if err := p.Scan(ctx, func(msg ParsedMessage) error { return nil }); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestParallelScannerHeaderOrder(t *testing.T) {
+	mbox := "From herp.derp@example.com Thu Jan  1 00:00:01 2015\n" +
+		"Subject: Test\nX-Mailer: Herp\nFrom: herp.derp@example.com\n\nTest.\n\n"
+	p := NewParallelScanner(strings.NewReader(mbox), int64(len(mbox)))
+	b := &bytes.Buffer{}
+	w := NewWriter(b)
+	w.SetLineEnding(LF)
+	if err := p.Scan(context.Background(), func(msg ParsedMessage) error {
+		_, err := w.WriteMessageEnvelope(msg.Message, msg.Envelope)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != mbox {
+		t.Errorf("Invalid mbox output:\n%q\nexpected:\n%q", b.String(), mbox)
+	}
+}
+
+func TestParallelScannerChunkSizes(t *testing.T) {
+	// messages directly followed by the next From_ line, with mixed line
+	// endings and bodies containing From_ lines that do not start a message
+	b := &strings.Builder{}
+	for i := 0; i < 60; i++ {
+		newline := "\n"
+		if i%3 == 0 {
+			newline = "\r\n"
+		}
+		fmt.Fprintf(b, "From herp.derp@example.com  Thu Jan  1 00:00:01 2015%sFrom: herp.derp@example.com%sSubject: %d%s%s", newline, newline, i, newline, newline)
+		fmt.Fprintf(b, "Message %d.%sFrom nobody  Thu Jan  1 00:00:01 2015%s%s%s", i, newline, newline, strings.Repeat("x", i%7), newline)
+		if i%2 == 0 {
+			b.WriteString(newline)
+		}
+	}
+	mbox := b.String()
+	expected := sequentialMessages(t, mbox, Mboxo)
+	for size := int64(1); size < 400; size += 7 {
+		p := NewParallelScanner(strings.NewReader(mbox), int64(len(mbox)))
+		p.SetWorkers(3)
+		p.SetChunkSize(size)
+		var got []string
+		err := p.Scan(context.Background(), func(msg ParsedMessage) error {
+			b, err := ioutil.ReadAll(msg.Message.Body)
+			if err != nil {
+				return err
+			}
+			got = append(got, fmt.Sprintf("%d-%d %s %q", msg.Start, msg.End, msg.Message.Header.Get("Subject"), b))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("chunk size %d: messages differ from Scanner:\n%s\nexpected:\n%s", size, strings.Join(got, "\n"), strings.Join(expected, "\n"))
+			break
+		}
+	}
+}
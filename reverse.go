@@ -0,0 +1,312 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"net/mail"
+	"strconv"
+)
+
+// ReverseScanner reads the messages of an mbox provided by an io.ReaderAt
+// backwards, starting with the last message. It locates each message by
+// searching backwards for a From_ line followed by a valid header, like a
+// Scanner does, so only the messages returned and their surroundings are read.
+//
+// ReverseScanner is used like Scanner: Next steps through the messages, which
+// are then accessed by calling Message, Envelope and Position.
+type ReverseScanner struct {
+	r       io.ReaderAt
+	size    int64
+	end     int64 // end of the next message to return
+	m       *Scanner
+	variant Variant
+	started bool
+	err     error
+}
+
+// NewReverseScanner returns a new *ReverseScanner to read the size bytes of mbox
+// data provided by r, starting at the end.
+func NewReverseScanner(r io.ReaderAt, size int64) *ReverseScanner {
+	return &ReverseScanner{r: r, size: size, end: size}
+}
+
+// SetVariant sets the mbox variant, see Scanner.SetVariant. The default is
+// Mboxo.
+//
+// Bodies of Mboxcl2 may contain unescaped From_ lines, so for Mboxcl2 a From_
+// line is not taken to start a message if the Content-Length header of an
+// earlier message spans it. The earlier message is searched for up to a message
+// with a valid Content-Length header, so reading Mboxcl2 lacking such headers
+// reads back to the start of the mbox for every message. Messages of MMDF are
+// located by their delimiter lines.
+//
+// SetVariant panics if it is called after scanning has started.
+func (s *ReverseScanner) SetVariant(v Variant) {
+	if s.started {
+		panic("SetVariant called after Next")
+	}
+	s.variant = v
+}
+
+// bodyEnd returns the end of the body of the message at off according to its
+// Content-Length header. ok is false if the message has no valid one.
+func (s *ReverseScanner) bodyEnd(off int64) (end int64, ok bool, err error) {
+	m := NewScanner(io.NewSectionReader(s.r, off, s.size-off), false)
+	m.SetVariant(Mboxo)
+	if !m.Next() {
+		return 0, false, m.Err()
+	}
+	length, err := strconv.ParseInt(m.Message().Header.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return 0, false, nil
+	}
+	return off + m.read + length, true, nil
+}
+
+// endsAt reports whether only line endings separate off from end.
+func (s *ReverseScanner) endsAt(off, end int64) (bool, error) {
+	if off > end || end-off > 4 {
+		return false, nil
+	}
+	b := make([]byte, end-off)
+	if _, err := s.r.ReadAt(b, off); err != nil && err != io.EOF {
+		return false, err
+	}
+	return len(skipLineEnding(skipLineEnding(b))) == 0, nil
+}
+
+// lines calls f with the offsets of the lines starting with prefix before end,
+// last one first, until f returns false.
+func (s *ReverseScanner) lines(end int64, prefix string, f func(off int64) (bool, error)) error {
+	pattern := []byte("\n" + prefix)
+	buf := make([]byte, 64*1024)
+	for hi := end; hi > 0; {
+		lo := hi - int64(len(buf))
+		if lo < 0 {
+			lo = 0
+		}
+		data := buf[:hi-lo]
+		if _, err := s.r.ReadAt(data, lo); err != nil && err != io.EOF {
+			return err
+		}
+		for k := len(data); k > 0; {
+			i := bytes.LastIndex(data[:k], pattern)
+			start := lo + int64(i+1)
+			if i == -1 {
+				if lo > 0 || !bytes.HasPrefix(data, []byte(prefix)) {
+					break
+				}
+				start = 0
+			}
+			if start < end {
+				if more, err := f(start); err != nil || !more {
+					return err
+				}
+			}
+			if i == -1 {
+				break
+			}
+			k = i
+		}
+		if lo == 0 {
+			break
+		}
+		// the pattern may span the start of the data read
+		hi = lo + int64(len(pattern)) - 1
+	}
+	return nil
+}
+
+// previousSeparator returns the offset of the From_ line starting the message
+// that ends at end. found is false if there is none.
+//
+// Like for a Scanner, the first From_ line of the mbox starts a message
+// regardless of its header, every later one has to be followed by a valid
+// header.
+//
+// Bodies of Mboxcl2 may contain unescaped From_ lines. A From_ line is skipped
+// if the Content-Length header of an earlier message spans it and points to
+// end. The search goes on past earlier From_ lines without a valid
+// Content-Length header, which may be part of the same body, up to a message
+// ending before the From_ line found.
+func (s *ReverseScanner) previousSeparator(end int64) (off int64, found bool, err error) {
+	// spans reports whether the body of the message at start ends at end
+	spans := func(start int64) (ok, stop bool, err error) {
+		e, ok, err := s.bodyEnd(start)
+		if err != nil || !ok {
+			return false, err != nil, err
+		}
+		if e <= off {
+			// the earlier message ends before the From_ line found
+			return false, true, nil
+		}
+		ok, err = s.endsAt(e, end)
+		return ok, ok || err != nil, err
+	}
+
+	off = -1
+	first := int64(-1) // earliest From_ line without a valid header
+	stopped := false
+	err = s.lines(end, "From ", func(start int64) (bool, error) {
+		from, ok, err := separatorAt(s.r, start, s.size)
+		if err != nil || !from {
+			return err == nil, err
+		}
+		if !ok {
+			first = start
+			return true, nil
+		}
+		first = -1
+		if off == -1 {
+			off = start
+			stopped = s.variant != Mboxcl2
+			return !stopped, nil
+		}
+		ok, stop, err := spans(start)
+		if ok {
+			off = start
+		}
+		stopped = stop
+		return !stop, err
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if !stopped && first != -1 {
+		// the search reached the first From_ line of the mbox
+		if off == -1 {
+			off = first
+		} else if s.variant == Mboxcl2 {
+			ok, _, err := spans(first)
+			if err != nil {
+				return 0, false, err
+			}
+			if ok {
+				off = first
+			}
+		}
+	}
+	if off == -1 {
+		return 0, false, nil
+	}
+	return off, true, nil
+}
+
+// previousDelimiter returns the offset of the opening delimiter line of the
+// MMDF message whose closing delimiter line is the last one before end. found
+// is false if there is none.
+func (s *ReverseScanner) previousDelimiter(end int64) (off int64, found bool, err error) {
+	delimiters := 0
+	err = s.lines(end, mmdfDelimiter, func(start int64) (bool, error) {
+		line := make([]byte, len(mmdfDelimiter)+2)
+		n, err := s.r.ReadAt(line, start)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		line = line[:n]
+		if e := bytes.IndexByte(line, '\n'); e != -1 {
+			line = line[:e+1]
+		}
+		if isMMDFDelimiter(line) {
+			delimiters++
+			off = start
+		}
+		return delimiters < 2, nil
+	})
+	if err != nil || delimiters < 2 {
+		return 0, false, err
+	}
+	return off, true, nil
+}
+
+// Next steps to the previous message and returns true. It returns false if
+// there are no messages left or an error occurs, see Scanner.Next.
+func (s *ReverseScanner) Next() bool {
+	if !s.started {
+		s.started = true
+		if s.variant == Auto {
+			d, err := DetectAt(io.NewSectionReader(s.r, 0, s.size))
+			if err != nil {
+				s.err = err
+			}
+			s.variant = d.Variant
+		}
+	}
+	s.m = nil
+	if s.err != nil || s.end <= 0 {
+		return false
+	}
+
+	previous := s.previousSeparator
+	if s.variant == MMDF {
+		previous = s.previousDelimiter
+	}
+	for {
+		off, found, err := previous(s.end)
+		if err != nil {
+			s.err = err
+			return false
+		}
+		if !found {
+			s.end = 0
+			return false
+		}
+
+		// The message is read up to the end of the mbox rather than to
+		// s.end, so it ends at the next message exactly as it does for a
+		// Scanner.
+		m := NewScanner(io.NewSectionReader(s.r, off, s.size-off), false)
+		m.SetVariant(s.variant)
+		if !m.Next() {
+			s.err = m.Err()
+			if s.err == nil {
+				s.err = ErrInvalidMboxFormat
+			}
+			return false
+		}
+		if m.pos.Start > 0 {
+			// the header of the message at off could not be parsed, a
+			// Scanner skips it as well
+			s.end = off
+			continue
+		}
+		m.pos.Start += off
+		m.read += off
+		s.m = m
+		s.end = off
+		return true
+	}
+}
+
+// Err returns the first error that occured while calling Next.
+func (s *ReverseScanner) Err() error {
+	return s.err
+}
+
+// Message returns the current message. Its body is read from the mbox as the
+// Body is read, until Next is called again. Message returns nil if Next has not
+// returned true.
+func (s *ReverseScanner) Message() *mail.Message {
+	if s.m == nil {
+		return nil
+	}
+	return s.m.Message()
+}
+
+// Envelope returns the From_ line of the current message, or nil if Message
+// returns nil.
+func (s *ReverseScanner) Envelope() *Envelope {
+	if s.m == nil {
+		return nil
+	}
+	return s.m.Envelope()
+}
+
+// Position returns the location of the current message within the mbox, see
+// Scanner.Position.
+func (s *ReverseScanner) Position() Position {
+	if s.m == nil {
+		return Position{}
+	}
+	return s.m.Position()
+}
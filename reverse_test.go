@@ -0,0 +1,95 @@
+package mbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// reverseMessages returns the messages of mbox read by a ReverseScanner.
+func reverseMessages(t *testing.T, mbox string, v Variant) []string {
+	var messages []string
+	m := NewReverseScanner(strings.NewReader(mbox), int64(len(mbox)))
+	m.SetVariant(v)
+	for m.Next() {
+		b, err := ioutil.ReadAll(m.Message().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, fmt.Sprintf("%d-%d %s %q", m.Position().Start, m.Position().End, m.Message().Header.Get("Subject"), b))
+	}
+	if m.Err() != nil {
+		t.Fatal(m.Err())
+	}
+	return messages
+}
+
+func TestReverseScanner(t *testing.T) {
+	// a body of Mboxcl2 with two unescaped From_ lines
+	body := mboxclFirstBody + "\nFrom bernd.lauert at example.com  Thu Jan  3 00:00:01 2015\n" +
+		"From: bernd.lauert at example.com (Bernd Lauert)\nSubject: Forwarded too\n\nAnother one.\n"
+	twoFroms := strings.Replace(mboxclMessages(len(body), len(mboxclSecondBody)), mboxclFirstBody, body, 1)
+
+	for _, test := range []struct {
+		name    string
+		mbox    string
+		variant Variant
+	}{
+		{"mboxo", parallelTestMbox(700), Mboxo},
+		{"leading junk", "junk\n\n" + parallelTestMbox(3), Mboxo},
+		{"mboxcl2", strings.Repeat(mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody)), 3), Mboxcl2},
+		{"mboxcl2 with two From_ lines in a body", twoFroms + twoFroms, Mboxcl2},
+		{"auto", strings.Repeat(mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody)), 3), Auto},
+		{"empty", "", Mboxo},
+		{"first header of one field", "From a@b Thu Jan  1 00:00:01 2015\nSubject: hi\n\nbody\n", Mboxo},
+		{"first header of one field followed by messages", "From a@b Thu Jan  1 00:00:01 2015\nSubject: hi\n\nbody\n\n" + parallelTestMbox(2), Mboxo},
+		{"empty first header", "From a@b Thu Jan  1 00:00:01 2015\n\nbody\n\n" + parallelTestMbox(2), Mboxo},
+		{"broken first header", "junk\nFrom a@b Thu Jan  1 00:00:01 2015\nbroken\n\nbody\n\n" + parallelTestMbox(2), Mboxo},
+		{"mboxcl2 with first header of one field", "From a@b Thu Jan  1 00:00:01 2015\nContent-Length: 5\n\nbody\n\n" +
+			strings.Repeat(mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody)), 2), Mboxcl2},
+	} {
+		v := test.variant
+		if v == Auto {
+			v = Mboxcl2
+		}
+		expected := sequentialMessages(t, test.mbox, v)
+		got := reverseMessages(t, test.mbox, test.variant)
+		if len(got) != len(expected) {
+			t.Errorf("%s: Expected %d messages, got %d", test.name, len(expected), len(got))
+			continue
+		}
+		for i := range got {
+			if e := expected[len(expected)-1-i]; got[i] != e {
+				t.Errorf("%s: Expected message %d to be %s, got %s", test.name, i, e, got[i])
+			}
+		}
+	}
+}
+
+// countingReaderAt counts the bytes read from an io.ReaderAt.
+type countingReaderAt struct {
+	r *strings.Reader
+	n int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n += n
+	return n, err
+}
+
+func TestReverseScannerReadsEnd(t *testing.T) {
+	mbox := parallelTestMbox(5000)
+	r := &countingReaderAt{r: strings.NewReader(mbox)}
+	m := NewReverseScanner(r, int64(len(mbox)))
+	if !m.Next() {
+		t.Fatal(m.Err())
+	}
+	if s := m.Message().Header.Get("Subject"); s != "4999" {
+		t.Errorf("Expected the last message, got %q", s)
+	}
+	if r.n >= len(mbox)/2 {
+		t.Errorf("Expected the end of the mbox to be read only, read %d of %d bytes", r.n, len(mbox))
+	}
+}
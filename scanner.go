@@ -9,32 +9,62 @@ package mbox
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"net/mail"
 	"net/textproto"
+	"os"
+	"strconv"
 )
 
-// ErrInvalidMboxFormat is the error returned by the Next method of type Mbox if
-// its content is malformed in a way that it is not possible to extract a
-// message.
+// ErrInvalidMboxFormat is the error reported by a Scanner in strict mode if its
+// content is malformed. The error returned is a *ParseError describing the
+// problem, for which errors.Is reports ErrInvalidMboxFormat.
 var ErrInvalidMboxFormat = errors.New("invalid mbox format")
 
-// scanHeader is a split function for a bufio.Scanner that returns a messages headers in
-// RFC 822 format or an error.
-func scanHeader(data []byte, atEOF bool) (int, []byte, error) {
-	if len(data) == 0 && atEOF {
-		return 0, nil, nil
+// isEmptyLine reports whether line consists of a line ending only.
+func isEmptyLine(line []byte) bool {
+	return string(line) == "\n" || string(line) == "\r\n"
+}
+
+// headerEnd returns the position just past the empty line ending the header at
+// the start of data, or -1 if data does not contain the end of the header.
+// Lines may end with "\n" or "\r\n".
+func headerEnd(data []byte) int {
+	// the search stops at the first empty line, whatever its line ending
+	for pos := 0; ; {
+		e := bytes.IndexByte(data[pos:], '\n')
+		if e == -1 {
+			return -1
+		}
+		pos += e + 1
+		if rest := data[pos:]; bytes.HasPrefix(rest, []byte("\n")) {
+			return pos + 1
+		} else if bytes.HasPrefix(rest, []byte("\r\n")) {
+			return pos + 2
+		}
 	}
-	e := bytes.Index(data, []byte("\n\n\n"))
-	if e == -1 && !atEOF {
-		// request more data
-		return 0, nil, nil
+}
+
+// isFromLine reports whether line, without its line ending, is a From_ line
+// separating two messages. A trailing "\r" is ignored. Besides lines ending in
+// a year, the From_ lines with a time zone or a "remote from" suffix accepted
+// by ParseEnvelope are recognized.
+func isFromLine(line []byte) bool {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if !bytes.HasPrefix(line, []byte("From ")) || len(line) < 9 {
+		return false
 	}
-	if atEOF {
-		return len(data), data, nil
+	l := len(line)
+	if line[l-1] <= '9' && line[l-1] >= '0' &&
+		line[l-2] <= '9' && line[l-2] >= '0' &&
+		line[l-3] <= '9' && line[l-3] >= '0' &&
+		(line[l-4] == '1' || line[l-4] == '2') {
+		return true
 	}
-	return e + 3, data[:e+3], nil
+	env, err := ParseEnvelope(string(line))
+	return err == nil && !env.Date.IsZero()
 }
 
 func findFroms(data []byte) (int, int) {
@@ -53,10 +83,7 @@ func findFroms(data []byte) (int, int) {
 			return -1, -1
 		}
 		nextLine += fromPos + 1
-		if data[nextLine-1] <= '9' && data[nextLine-1] >= '0' &&
-			data[nextLine-2] <= '9' && data[nextLine-2] >= '0' &&
-			data[nextLine-3] <= '9' && data[nextLine-3] >= '0' &&
-			(data[nextLine-4] == '1' || data[nextLine-4] == '2') {
+		if isFromLine(bytes.TrimPrefix(data[fromPos:nextLine], []byte("\n"))) {
 			return fromPos, nextLine + 1
 		}
 		curPos = nextLine
@@ -64,7 +91,10 @@ func findFroms(data []byte) (int, int) {
 }
 
 // scanMessage is a split function for a bufio.Scanner that returns a message in
-// RFC 822 format or an error.
+// RFC 822 format or an error. It is the split function the Scanner was first
+// built on and is kept as a reference for the tests of the From_ line rules.
+// Scanner and everything built on it find messages with Scanner.next and
+// body.fill instead.
 func scanMessage(data []byte, atEOF bool) (int, []byte, error) {
 	if len(data) == 0 && atEOF {
 		return 0, nil, nil
@@ -84,24 +114,98 @@ func scanMessage(data []byte, atEOF bool) (int, []byte, error) {
 		//log.Printf("start=%d, end=%d,priorStart=%d,priorEnd=%d,data=%s", start, end, priorStart, priorEnd, data[curEnd:])
 		if priorStart == -1 || priorEnd == -1 {
 			if atEOF { // have the initial From header, just want to return what we have without finding the next one
+				// drop the empty line separating the message from the next one
+				if bytes.HasSuffix(data[end:], []byte("\n\n")) {
+					return len(data), data[end : len(data)-1], nil
+				}
+				if bytes.HasSuffix(data[end:], []byte("\n\r\n")) {
+					return len(data), data[end : len(data)-2], nil
+				}
 				return len(data), data[end:], nil
 			}
 			return 0, nil, nil
 		}
 		curStart, curEnd = priorStart+curEnd, priorEnd+curEnd
-		if bytes.Index(data[curEnd:], []byte("\n\n")) == -1 {
-			// must be a blank after the headers before content
+		ok, more := validHeader(data[curEnd:], atEOF)
+		if more {
 			return 0, nil, nil // get more, end of header hasn't yet come
 		}
-		tpr := textproto.NewReader(bufio.NewReader(bytes.NewReader(data[curEnd:])))
-		header, err := tpr.ReadMIMEHeader()
-		if err != nil || len(header) < 2 {
+		if !ok {
 			// error processing header, probably not a valid message!  move on!
 			continue
 		}
 		//if len(header) >= 2 { // found my next proper From!
-		return curStart - 1, data[end:curStart], nil
+		// drop the empty line separating the message from the next one,
+		// including the "\r" of a "\r\n" line ending
+		msgEnd := curStart
+		if msgEnd > end && data[msgEnd-1] == '\r' {
+			msgEnd--
+		}
+		return curStart + 1, data[end:msgEnd], nil
+	}
+}
+
+// skipLineEnding returns data without a single leading "\n" or "\r\n".
+func skipLineEnding(data []byte) []byte {
+	if bytes.HasPrefix(data, []byte("\r\n")) {
+		return data[2:]
+	}
+	if bytes.HasPrefix(data, []byte("\n")) {
+		return data[1:]
+	}
+	return data
+}
+
+// mmdfDelimiter is the line enclosing every message of an MMDF mailbox.
+const mmdfDelimiter = "\x01\x01\x01\x01"
+
+// isMMDFDelimiter reports whether line, with or without its line ending, is
+// the delimiter line of MMDF.
+func isMMDFDelimiter(line []byte) bool {
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+	return string(line) == mmdfDelimiter
+}
+
+// validHeader reports whether data, following a From_ line, starts with a
+// message header of at least two fields. If data does not contain the end of
+// the header and atEOF is false, more is true. Otherwise the complete lines of
+// data are taken to be the header.
+func validHeader(data []byte, atEOF bool) (ok, more bool) {
+	if e := headerEnd(data); e != -1 {
+		data = data[:e]
+	} else {
+		if !atEOF {
+			return false, true
+		}
+		e = bytes.LastIndexByte(data, '\n')
+		if e == -1 {
+			return false, false
+		}
+		data = append(data[:e+1:e+1], '\n')
 	}
+	tpr := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	header, err := tpr.ReadMIMEHeader()
+	return err == nil && len(header) >= 2, false
+}
+
+// validLengthEnd reports whether data, following a body delimited by its
+// Content-Length header, consists of the line ending of the last line of the
+// body and the empty line separating messages, followed by a From_ line or the
+// end of the mbox. If more data is needed to tell and atEOF is false, more is
+// true.
+func validLengthEnd(data []byte, atEOF bool) (ok, more bool) {
+	rest := skipLineEnding(skipLineEnding(data))
+	if len(rest) == 0 {
+		return atEOF, !atEOF
+	}
+	if fromStart, _ := findFroms(rest); fromStart == 0 {
+		return true, false
+	}
+	if !atEOF && bytes.IndexByte(rest, '\n') == -1 {
+		// the next From_ line is incomplete
+		return false, true
+	}
+	return false, false
 }
 
 // Scanner provides an interface to read a sequence of messages from an mbox.
@@ -117,50 +221,488 @@ func scanMessage(data []byte, atEOF bool) (int, []byte, error) {
 // using Next. If Next returned true, you can expect Message to return a valid
 // *mail.Message.
 type Scanner struct {
-	s       *bufio.Scanner
+	src     io.Reader
+	r       *bufio.Reader
+	bufSize int
 	m       *mail.Message
-	curByte int
+	env     *Envelope
+	body    *body
+	head    []byte // From_ line and header of the current message
+	header  int    // start of the header in head
+	raw     []byte
+	pos     Position
+	read    int64
+	lines   int // number of line endings consumed
+	capture *bytes.Buffer
+	variant Variant
+	headers bool
+	strict  bool
+	started bool
+	report  func(Diagnostic)
 	err     error
+
+	ctx      context.Context // context of the last call to NextContext
+	progress func(Progress)
+	size     int64 // size of the mbox, -1 if unknown
+	count    int   // number of messages found
+}
+
+// Position is the location of a message within an mbox.
+type Position struct {
+	// Start is the offset of the first byte of the From_ line.
+	Start int64
+
+	// End is the offset just past the message, including the empty line
+	// separating it from the next message.
+	End int64
+}
+
+// Len returns the length of the message in bytes.
+func (p Position) Len() int64 {
+	return p.End - p.Start
 }
 
 // NewScanner returns a new *Scanner to read messages from mbox file format data
 // provided by io.Reader r.
 func NewScanner(r io.Reader, headers bool) *Scanner {
-	s := bufio.NewScanner(r)
-	if headers {
-		s.Split(scanHeader)
-	} else {
-		s.Split(scanMessage)
+	return &Scanner{src: r, headers: headers, bufSize: bufio.MaxScanTokenSize, size: -1}
+}
+
+// Progress describes how far a Scanner has read an mbox, see
+// Scanner.SetProgress.
+type Progress struct {
+	// Read is the number of bytes consumed from the mbox.
+	Read int64
+
+	// Size is the size of the mbox in bytes, or -1 if it is not known.
+	Size int64
+
+	// Messages is the number of messages found so far.
+	Messages int
+}
+
+// sourceSize returns the number of bytes left to read from r, or -1 if it
+// cannot be told. It knows about files and readers with a Size method like
+// *strings.Reader and *io.SectionReader.
+func sourceSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *os.File:
+		fi, err := r.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return -1
+		}
+		off, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return fi.Size() - off
+	case interface{ Size() int64 }:
+		return r.Size()
+	}
+	return -1
+}
+
+// contextReader reads from the source of a Scanner as long as the context of
+// the Scanner is not done.
+type contextReader struct {
+	m *Scanner
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if r.m.ctx != nil {
+		if err := r.m.ctx.Err(); err != nil {
+			return 0, err
+		}
 	}
-	return &Scanner{s: s}
+	return r.m.src.Read(p)
+}
+
+// start sets up the buffered reader, detecting the variant of the mbox first
+// if necessary.
+func (m *Scanner) start() {
+	m.started = true
+	m.size = sourceSize(m.src)
+	m.r = bufio.NewReaderSize(contextReader{m}, m.bufSize)
+	if m.variant == Auto && !m.headers {
+		sample, err := m.r.Peek(detectSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			m.err = err
+		}
+		m.variant = detect(sample, err == io.EOF).Variant
+	}
+}
+
+// advance records that b has been consumed from the mbox.
+func (m *Scanner) advance(b []byte) {
+	m.read += int64(len(b))
+	m.lines += bytes.Count(b, []byte("\n"))
+	if m.capture != nil {
+		m.capture.Write(b)
+	}
+}
+
+// readSlice reads up to and including the next '\n' like
+// bufio.Reader.ReadSlice, but returns a buffer full of data instead of
+// bufio.ErrBufferFull for overlong lines. The returned slice is only valid until
+// the next read.
+func (m *Scanner) readSlice() ([]byte, error) {
+	b, err := m.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		err = nil
+	}
+	m.advance(b)
+	return b, err
+}
+
+// readLine appends the next line, including its line ending, to buf.
+func (m *Scanner) readLine(buf []byte) ([]byte, error) {
+	for {
+		b, err := m.readSlice()
+		buf = append(buf, b...)
+		if err != nil || bytes.HasSuffix(b, []byte("\n")) {
+			return buf, err
+		}
+	}
+}
+
+// readAtMost reads up to n buffered bytes, reading more data only if nothing
+// is buffered. The returned slice is only valid until the next read.
+func (m *Scanner) readAtMost(n int64) ([]byte, error) {
+	if m.r.Buffered() == 0 {
+		if _, err := m.r.Peek(1); err != nil {
+			return nil, err
+		}
+	}
+	k := m.r.Buffered()
+	if int64(k) > n {
+		k = int(n)
+	}
+	b, _ := m.r.Peek(k)
+	m.r.Discard(k)
+	m.advance(b)
+	return b, nil
+}
+
+// peekLine returns the next line without consuming it. If the line does not
+// fit into the buffer or is not terminated, it returns what is available along
+// with bufio.ErrBufferFull or io.EOF.
+func (m *Scanner) peekLine() ([]byte, error) {
+	for n := 512; ; n *= 2 {
+		if n > m.r.Size() {
+			n = m.r.Size()
+		}
+		b, err := m.r.Peek(n)
+		if e := bytes.IndexByte(b, '\n'); e != -1 {
+			return b[:e+1], nil
+		}
+		if err != nil {
+			return b, err
+		}
+		if n == m.r.Size() {
+			return b, bufio.ErrBufferFull
+		}
+	}
+}
+
+// atSeparator reports whether the next line starts a new message. Like
+// scanMessage it requires a From_ line followed by a header of at least two
+// fields. The header must fit into the buffer to be taken into account. from
+// reports whether the next line is a From_ line, regardless of its header.
+func (m *Scanner) atSeparator() (from, ok bool) {
+	line, err := m.peekLine()
+	if err != nil || !isFromLine(bytes.TrimSuffix(line, []byte("\n"))) {
+		return false, false
+	}
+	for n := len(line) + 512; ; n *= 2 {
+		if n > m.r.Size() {
+			n = m.r.Size()
+		}
+		b, err := m.r.Peek(n)
+		final := err != nil || n == m.r.Size()
+		if ok, more := validHeader(b[len(line):], final); !more {
+			return true, ok
+		}
+	}
+}
+
+// diagnose reports d to the function set by SetDiagnostics.
+func (m *Scanner) diagnose(d Diagnostic) {
+	if m.report != nil {
+		m.report(d)
+	}
+}
+
+// parseError returns a *ParseError for a problem found at the current position
+// of m.
+func (m *Scanner) parseError(reason Reason, err error) *ParseError {
+	return &ParseError{Offset: m.read, Line: m.lines + 1, Reason: reason, Err: err}
+}
+
+// lengthEnd verifies that a body of length bytes delimited by Content-Length
+// starts at the current position. unknown is true if the body does not fit
+// into the buffer.
+func (m *Scanner) lengthEnd(length int64) (ok, unknown bool) {
+	for n := int64(512); ; n *= 2 {
+		if length+n > int64(m.r.Size()) {
+			n = int64(m.r.Size()) - length
+		}
+		if n <= 0 {
+			return false, true
+		}
+		b, err := m.r.Peek(int(length + n))
+		if int64(len(b)) < length {
+			if err == io.EOF {
+				return false, false
+			}
+			return false, true
+		}
+		ok, more := validLengthEnd(b[length:], err == io.EOF)
+		if !more || err != nil || length+n == int64(m.r.Size()) {
+			return ok, false
+		}
+	}
+}
+
+// skipLengthEnd consumes the line endings following a body delimited by
+// Content-Length and reports whether they are followed by the next From_ line
+// or the end of the mbox. If not, nothing is consumed.
+func (m *Scanner) skipLengthEnd() bool {
+	if ok, _ := m.lengthEnd(0); !ok {
+		return false
+	}
+	b, _ := m.r.Peek(4)
+	n := len(b) - len(skipLineEnding(skipLineEnding(b)))
+	m.r.Discard(n)
+	m.advance(b[:n])
+	return true
 }
 
+// Location returns the number of bytes consumed from the mbox so far.
 func (m *Scanner) Location() int {
-	return m.curByte
+	return int(m.read)
 }
 
 // Next skips to the next message and returns true. It will return false if
 // there are no messages left or an error occurs. You can call the Err method to
 // check if an error occured. If Next returns false and Err returns nil there
 // are no messages left.
+//
+// Any part of the body of the current message not read yet is skipped.
 func (m *Scanner) Next() bool {
-	m.m = nil
+	m.ctx = nil
+	return m.scan()
+}
+
+// NextContext is like Next, but stops reading the mbox once ctx is done, in
+// which case Err returns the error of ctx. The context also applies to
+// reading the body of the current message, until Next or NextContext is
+// called again.
+func (m *Scanner) NextContext(ctx context.Context) bool {
+	m.ctx = ctx
+	if err := ctx.Err(); err != nil && m.err == nil {
+		m.m, m.env, m.body, m.raw = nil, nil, nil, nil
+		m.err = err
+	}
+	return m.scan()
+}
+
+// scan skips to the next message and reports the progress made.
+func (m *Scanner) scan() bool {
+	ok := m.next()
+	if ok {
+		m.count++
+	}
+	if m.progress != nil {
+		m.progress(Progress{Read: m.read, Size: m.size, Messages: m.count})
+	}
+	return ok
+}
+
+// next skips to the next message, see Next.
+func (m *Scanner) next() bool {
+	if !m.started {
+		m.start()
+	}
+	if m.body != nil {
+		m.body.discard()
+		if m.body.err != io.EOF {
+			m.err = m.body.err
+		}
+	}
+	m.m, m.env, m.body, m.raw = nil, nil, nil, nil
 	if m.err != nil {
 		return false
 	}
 
-	if !m.s.Scan() {
-		m.err = m.s.Err()
-		return false
+	if m.headers {
+		return m.nextHeader()
 	}
-	m.curByte += len(m.s.Bytes())
-	m.m, m.err = mail.ReadMessage(bytes.NewReader(m.s.Bytes()))
-	if m.err != nil {
+
+	// skip anything up to the next From_ line
+	skipped := Diagnostic{Position: Position{Start: m.read}, Line: m.lines + 1, Reason: NoFromLine}
+	for {
+		line, err := m.peekLine()
+		if len(line) == 0 && err == io.EOF {
+			if m.read > skipped.Start {
+				skipped.End, skipped.Reason = m.read, TrailingData
+				m.diagnose(skipped)
+			}
+			return false
+		}
+		if m.variant == MMDF && err == nil && isMMDFDelimiter(line) {
+			break
+		}
+		if m.variant != MMDF && err == nil && isFromLine(bytes.TrimSuffix(line, []byte("\n"))) {
+			break
+		}
+		if m.strict {
+			m.err = m.parseError(NoFromLine, nil)
+			return false
+		}
+		if _, err := m.readLine(nil); err != nil && err != io.EOF {
+			m.err = err
+			return false
+		}
+	}
+	if m.read > skipped.Start {
+		skipped.End = m.read
+		m.diagnose(skipped)
+	}
+
+	m.pos = Position{Start: m.read, End: -1}
+	invalid := Diagnostic{Position: Position{Start: m.read}, Line: m.lines + 1, Reason: InvalidHeader}
+	var err error
+	if m.head, err = m.readLine(m.head[:0]); err != nil {
+		m.err = err
 		return false
 	}
+	if m.variant != MMDF {
+		// a From_ line without a parseable date still names the sender
+		m.env, _ = ParseEnvelope(string(m.head))
+	}
+	header := len(m.head)
+	m.header = header
+	headerErr := m.parseError(InvalidHeader, nil)
+
+	for {
+		if m.variant == MMDF {
+			if line, _ := m.peekLine(); isMMDFDelimiter(line) {
+				// the message ends without a body
+				break
+			}
+		} else if head, _ := m.r.Peek(len("From ")); bytes.Equal(head, []byte("From ")) {
+			if _, ok := m.atSeparator(); ok {
+				// the message ends without a body
+				break
+			}
+		}
+		m.head, err = m.readLine(m.head)
+		if err == io.EOF {
+			if m.strict {
+				// the header is not terminated by an empty line
+				m.err = m.parseError(TruncatedMessage, nil)
+				return false
+			}
+			break
+		}
+		if err != nil {
+			m.err = err
+			return false
+		}
+		if line := m.head[bytes.LastIndexByte(m.head[:len(m.head)-1], '\n')+1:]; isEmptyLine(line) {
+			break
+		}
+	}
+
+	if m.m, err = mail.ReadMessage(bytes.NewReader(m.head[header:])); err != nil {
+		m.m = nil
+		if m.strict {
+			headerErr.Err = err
+			m.err = headerErr
+			return false
+		}
+		invalid.Err = err
+		return m.skipMessage(invalid)
+	}
+
+	length := int64(-1)
+	if m.variant.contentLength() {
+		if v := m.m.Header.Get("Content-Length"); v != "" {
+			l, err := strconv.ParseInt(v, 10, 64)
+			if err == nil && l >= 0 {
+				if ok, unknown := m.lengthEnd(l); ok || unknown {
+					length = l
+				}
+			}
+			if length == -1 && m.strict {
+				reason := InvalidContentLength
+				if err == nil && l >= 0 {
+					if _, err := m.r.Peek(int(l)); err == io.EOF {
+						reason = TruncatedMessage
+					}
+				}
+				m.err = m.parseError(reason, err)
+				return false
+			}
+			if length == -1 {
+				m.diagnose(Diagnostic{Position: Position{m.read, m.read}, Line: m.lines + 1, Reason: InvalidContentLength, Err: err})
+			}
+		}
+	}
+	m.body = newBody(m, length)
+	m.body.order = headerOrder(m.head[header:])
+	m.m.Body = m.body
 	return true
 }
 
+// skipMessage skips the body of a message whose header cannot be parsed, as
+// described by d, and continues with the next message. A message running up
+// to the end of the mbox may be truncated, so the error is returned instead.
+func (m *Scanner) skipMessage(d Diagnostic) bool {
+	b := newBody(m, -1)
+	b.discard()
+	if b.err != io.EOF {
+		m.err = b.err
+		return false
+	}
+	if line, _ := m.peekLine(); len(line) == 0 {
+		m.err = d.Err
+		return false
+	}
+	d.End = m.read
+	m.diagnose(d)
+	return m.next()
+}
+
+// nextHeader reads the next message of a Scanner reading headers only.
+func (m *Scanner) nextHeader() bool {
+	m.pos = Position{Start: m.read}
+	// a line ending followed by two empty lines ends the message
+	for empty, lineStart := 0, false; empty < 2; {
+		b, err := m.readSlice()
+		m.raw = append(m.raw, b...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			m.err = err
+			return false
+		}
+		if lineStart && isEmptyLine(b) {
+			empty++
+		} else {
+			empty = 0
+		}
+		lineStart = bytes.HasSuffix(b, []byte("\n"))
+	}
+	if len(m.raw) == 0 {
+		return false
+	}
+	m.pos.End = m.read
+	m.m, m.err = mail.ReadMessage(bytes.NewReader(m.raw))
+	return m.err == nil
+}
+
 // Err returns the first error that occured while calling Next.
 func (m *Scanner) Err() error {
 	return m.err
@@ -170,7 +712,8 @@ func (m *Scanner) Err() error {
 // skipped past the last message or if an error occured during a call to Next.
 //
 // If Next returned true, you can expect Message to return a valid
-// *mail.Message.
+// *mail.Message. Its header has been read completely, while its body is read
+// from the mbox as the Body is read.
 func (m *Scanner) Message() *mail.Message {
 	if m.err != nil {
 		return nil
@@ -178,10 +721,136 @@ func (m *Scanner) Message() *mail.Message {
 	return m.m
 }
 
-// Buffer sets the initial buffer to use when scanning and the maximum size of
-// buffer that may be allocated during scanning.
+// Envelope returns the From_ line of the current message. It returns nil if
+// Message returns nil or if the Scanner reads headers only.
+func (m *Scanner) Envelope() *Envelope {
+	if m.err != nil || m.m == nil {
+		return nil
+	}
+	return m.env
+}
+
+// Position returns the location of the current message within the mbox. It
+// returns the zero Position if Message returns nil.
+//
+// The end of the message is only known once its body has been read
+// completely, until then End is -1.
+func (m *Scanner) Position() Position {
+	if m.err != nil || m.m == nil {
+		return Position{}
+	}
+	return m.pos
+}
+
+// Raw returns the current message exactly as found in the mbox, starting with
+// its From_ line and including the empty line separating it from the next
+// message, as written by Writer.WriteVerbatim. It returns nil if Message returns
+// nil.
+//
+// Raw reads the rest of the message into memory, so the Body of the message
+// is read from memory afterwards. Raw returns nil if reading from the Body has
+// already begun.
+func (m *Scanner) Raw() []byte {
+	if m.err != nil || m.m == nil {
+		return nil
+	}
+	if m.headers {
+		return m.raw
+	}
+	return m.body.rawMessage()
+}
+
+// RawHeader returns the header of the current message exactly as found in the
+// mbox, including the empty line ending it. It returns nil if Message returns
+// nil.
+func (m *Scanner) RawHeader() []byte {
+	if m.err != nil || m.m == nil {
+		return nil
+	}
+	if m.headers {
+		return m.raw
+	}
+	return append([]byte{}, m.head[m.header:]...)
+}
+
+// SetVariant sets the mbox variant used to find the end of a message and to
+// unescape "From " lines inside messages. The default is Mboxo. If v is Auto,
+// the variant is detected from the start of the mbox when Next is called for
+// the first time.
+//
+// SetVariant has no effect on a Scanner reading headers only.
+//
+// SetVariant panics if it is called after scanning has started.
+func (m *Scanner) SetVariant(v Variant) {
+	if m.started {
+		panic("SetVariant called after Next")
+	}
+	m.variant = v
+}
+
+// Variant returns the mbox variant used by the Scanner. If the variant is to be
+// detected automatically, Variant returns Auto until Next is called.
+func (m *Scanner) Variant() Variant {
+	return m.variant
+}
+
+// SetStrict sets whether the Scanner rejects malformed mbox data instead of
+// skipping over it. The default is to be lenient. In strict mode Next returns
+// false and Err returns a *ParseError if
+//
+//   - anything but a From_ line is found where a message should start,
+//   - the header of a message cannot be parsed, or a From_ line following an
+//     empty line is not followed by a valid header,
+//   - the mbox ends in the middle of a line, a header or a body delimited by
+//     Content-Length, or
+//   - a Content-Length header does not point to the end of the message.
+//
+// Reading the body of a message returns the same error.
+//
+// SetStrict has no effect on a Scanner reading headers only.
+//
+// SetStrict panics if it is called after scanning has started.
+func (m *Scanner) SetStrict(strict bool) {
+	if m.started {
+		panic("SetStrict called after Next")
+	}
+	m.strict = strict
+}
+
+// SetDiagnostics sets a function to be called for every problem in the mbox
+// that the Scanner recovers from in lenient mode: data skipped before a From_
+// line or discarded at the end of the mbox, From_ lines in a body that are
+// rejected as the start of a message because of an invalid header, messages
+// skipped up to the next From_ line because their header cannot be parsed, and
+// Content-Length headers that turn out to be wrong. f is called from within
+// Next or while reading the body of a message.
+//
+// A message whose header cannot be parsed and which runs up to the end of the
+// mbox may be truncated. It is not skipped: Next returns false and Err returns
+// the error, without f being called.
+//
+// A Scanner in strict mode returns an error instead of calling f.
+func (m *Scanner) SetDiagnostics(f func(Diagnostic)) {
+	m.report = f
+}
+
+// SetProgress sets a function to be called with the progress made whenever
+// Next or NextContext returns. The size of the mbox is known if it is read
+// from a regular file or from a reader with a Size method.
+func (m *Scanner) SetProgress(f func(Progress)) {
+	m.progress = f
+}
+
+// Buffer sets the size of the buffer used to read the mbox to max bytes; buf
+// is not used. The default size is 64 KiB. The size of a message is not
+// limited by the buffer, but the Scanner looks at most that far ahead to tell
+// whether a From_ line or a Content-Length header marks the start of the next
+// message.
 //
 // Buffer panics if it is called after scanning has started.
 func (m *Scanner) Buffer(buf []byte, max int) {
-	m.s.Buffer(buf, max)
+	if m.started {
+		panic("Buffer called after Next")
+	}
+	m.bufSize = max
 }
@@ -2,10 +2,16 @@ package mbox
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 const mboxWithOneMessage = `From herp.derp at example.com  Thu Jan  1 00:00:01 2015
@@ -571,6 +577,361 @@ This is the second email in a test of boundaries.
 	}
 }
 
+const mboxrdWithEscapedFroms = `From herp.derp at example.com  Thu Jan  1 00:00:01 2015
+From: herp.derp at example.com (Herp Derp)
+Date: Thu, 01 Jan 2015 00:00:01 +0100
+Subject: Test
+
+>From the start.
+And, by the way, this is how "From" lines are escaped in mboxrd format:
+
+>From Herp Derp with love.
+>>From Herp Derp with more love.
+>>>From Herp Derp with even more love.
+ >From is not escaped.
+
+Bye.
+
+`
+
+const mboxrdUnescapedBody = `From the start.
+And, by the way, this is how "From" lines are escaped in mboxrd format:
+
+From Herp Derp with love.
+>From Herp Derp with more love.
+>>From Herp Derp with even more love.
+ >From is not escaped.
+
+Bye.
+`
+
+func TestScannerMboxrd(t *testing.T) {
+	tests := []struct {
+		variant  Variant
+		expected string
+	}{
+		{Mboxo, mboxrdWithEscapedFroms[strings.Index(mboxrdWithEscapedFroms, "\n\n")+2 : len(mboxrdWithEscapedFroms)-1]},
+		{Mboxrd, mboxrdUnescapedBody},
+	}
+	for _, test := range tests {
+		m := NewScanner(strings.NewReader(mboxrdWithEscapedFroms), false)
+		m.SetVariant(test.variant)
+		if !m.Next() {
+			t.Fatalf("%v - Next() failed: %v", test.variant, m.Err())
+		}
+		body := new(bytes.Buffer)
+		if _, err := body.ReadFrom(m.Message().Body); err != nil {
+			t.Fatalf("%v - Unexpected error reading message body: %v", test.variant, err)
+		}
+		if body.String() != test.expected {
+			t.Errorf("%v - Expected:\n %q\ngot\n%q", test.variant, test.expected, body.String())
+		}
+	}
+}
+
+func TestScannerSetVariantAfterNext(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("SetVariant after Next did not panic")
+		}
+	}()
+	m := NewScanner(strings.NewReader(mboxWithOneMessage), false)
+	m.Next()
+	m.SetVariant(Mboxrd)
+}
+
+const mboxclFirstBody = `This body contains an unescaped mbox:
+
+From derp.herp at example.com  Thu Jan  1 00:00:01 2015
+From: derp.herp at example.com (Derp Herp)
+Subject: Forwarded
+
+It would be mistaken for a message without Content-Length.
+`
+
+const mboxclSecondBody = `This is the second message.
+`
+
+func mboxclMessages(firstLength, secondLength int) string {
+	return fmt.Sprintf(`From herp.derp at example.com  Thu Jan  1 00:00:01 2015
+From: herp.derp at example.com (Herp Derp)
+Date: Thu, 01 Jan 2015 00:00:01 +0100
+Subject: Test
+Content-Length: %d
+
+%s
+From bernd.lauert at example.com  Thu Jan  3 00:00:01 2015
+From: bernd.lauert at example.com (Bernd Lauert)
+Date: Thu, 03 Jan 2015 00:00:01 +0100
+Subject: A last test
+Content-Length: %d
+
+%s
+`, firstLength, mboxclFirstBody, secondLength, mboxclSecondBody)
+}
+
+func TestScannerContentLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		variant  Variant
+		data     string
+		expected []string
+	}{
+		{
+			name:     "mboxcl2",
+			variant:  Mboxcl2,
+			data:     mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody)),
+			expected: []string{mboxclFirstBody, mboxclSecondBody},
+		},
+		{
+			name:     "mboxcl",
+			variant:  Mboxcl,
+			data:     mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody)),
+			expected: []string{mboxclFirstBody, mboxclSecondBody},
+		},
+		{
+			name:    "wrong length",
+			variant: Mboxcl2,
+			data:    mboxclMessages(10, len(mboxclSecondBody)+100),
+			expected: []string{
+				mboxclFirstBody[:strings.Index(mboxclFirstBody, "From derp")-1],
+				mboxclFirstBody[strings.Index(mboxclFirstBody, "It would"):],
+				mboxclSecondBody,
+			},
+		},
+		{
+			name:    "mboxo",
+			variant: Mboxo,
+			data:    mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody)),
+			expected: []string{
+				mboxclFirstBody[:strings.Index(mboxclFirstBody, "From derp")-1],
+				mboxclFirstBody[strings.Index(mboxclFirstBody, "It would"):],
+				mboxclSecondBody,
+			},
+		},
+	}
+	for _, test := range tests {
+		m := NewScanner(strings.NewReader(test.data), false)
+		m.SetVariant(test.variant)
+		for i, expected := range test.expected {
+			if !m.Next() {
+				t.Fatalf("%s - Next() failed; pass %d: %v", test.name, i, m.Err())
+			}
+			body := new(bytes.Buffer)
+			if _, err := body.ReadFrom(m.Message().Body); err != nil {
+				t.Fatalf("%s - Unexpected error reading message body: %v", test.name, err)
+			}
+			if body.String() != expected {
+				t.Errorf("%s - %d - Expected:\n %q\ngot\n%q", test.name, i, expected, body.String())
+			}
+		}
+		if m.Next() {
+			t.Errorf("%s - Next() succeeded", test.name)
+		}
+		if m.Err() != nil {
+			t.Errorf("%s - Unexpected error after Next(): %v", test.name, m.Err())
+		}
+	}
+}
+
+func TestScannerEnvelope(t *testing.T) {
+	expected := []*Envelope{
+		{
+			Sender: "herp.derp at example.com",
+			Date:   time.Date(2015, 1, 1, 0, 0, 1, 0, time.UTC),
+			Raw:    "From herp.derp at example.com  Thu Jan  1 00:00:01 2015",
+		},
+		{
+			Sender: "derp.herp at example.com",
+			Date:   time.Date(2015, 1, 1, 0, 0, 1, 0, time.UTC),
+			Raw:    "From derp.herp at example.com  Thu Jan  1 00:00:01 2015",
+		},
+		{
+			Sender: "bernd.lauert at example.com",
+			Date:   time.Date(2015, 1, 3, 0, 0, 1, 0, time.UTC),
+			Raw:    "From bernd.lauert at example.com  Thu Jan  3 00:00:01 2015",
+		},
+	}
+	m := NewScanner(strings.NewReader(mboxWithStartingLF), false)
+	if m.Envelope() != nil {
+		t.Errorf("envelope is not nil before Next()")
+	}
+	for i, e := range expected {
+		if !m.Next() {
+			t.Fatalf("Next() failed; pass %d: %v", i, m.Err())
+		}
+		got := m.Envelope()
+		if got == nil {
+			t.Errorf("envelope is nil; pass %d", i)
+			continue
+		}
+		if got.Sender != e.Sender || !got.Date.Equal(e.Date) || got.Raw != e.Raw {
+			t.Errorf("%d - Expected envelope %+v, got %+v", i, e, got)
+		}
+	}
+	if m.Next() {
+		t.Errorf("Next() succeeded")
+	}
+	if m.Envelope() != nil {
+		t.Errorf("envelope is not nil after the last message")
+	}
+}
+
+func TestScannerPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant Variant
+		data    string
+	}{
+		{"starting LF", Mboxo, mboxWithStartingLF},
+		{"one message", Mboxo, mboxWithOneMessage},
+		{"content length", Mboxcl2, mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody))},
+		{"wrong content length", Mboxcl2, mboxclMessages(10, 20)},
+	}
+	for _, test := range tests {
+		m := NewScanner(strings.NewReader(test.data), false)
+		m.SetVariant(test.variant)
+		var raw []byte
+		end := int64(-1)
+		for m.Next() {
+			if p := m.Position(); p.End != -1 {
+				t.Errorf("%s - End is known before reading the message: %+v", test.name, p)
+			}
+			m.Raw()
+			p := m.Position()
+			if end != -1 && p.Start != end {
+				t.Errorf("%s - message starts at %d, previous one ended at %d", test.name, p.Start, end)
+			}
+			end = p.End
+			if p.Len() != int64(len(m.Raw())) {
+				t.Errorf("%s - Len() = %d, but Raw() has %d bytes", test.name, p.Len(), len(m.Raw()))
+			}
+			if got := test.data[p.Start:p.End]; got != string(m.Raw()) {
+				t.Errorf("%s - Raw() = %q, expected %q", test.name, m.Raw(), got)
+			}
+			if !bytes.HasPrefix(m.Raw(), []byte(m.Envelope().Raw+"\n")) {
+				t.Errorf("%s - Raw() does not start with From_ line: %q", test.name, m.Raw())
+			}
+			if m.Location() != int(p.End) {
+				t.Errorf("%s - Location() = %d, expected %d", test.name, m.Location(), p.End)
+			}
+			raw = append(raw, m.Raw()...)
+		}
+		if m.Err() != nil {
+			t.Errorf("%s - Unexpected error after Next(): %v", test.name, m.Err())
+		}
+		if !strings.HasSuffix(test.data, string(raw)) || len(raw) != len(strings.TrimLeft(test.data, "\n")) {
+			t.Errorf("%s - Raw messages do not add up to the mbox:\n%q", test.name, raw)
+		}
+		if m.Raw() != nil {
+			t.Errorf("%s - Raw() is not nil after the last message", test.name)
+		}
+		if m.Position() != (Position{}) {
+			t.Errorf("%s - Position() is not zero after the last message", test.name)
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestScannerLargeMessage(t *testing.T) {
+	line := strings.Repeat("0123456789", 10) + "\n"
+	large := strings.Repeat(line, 100000) + "From the middle of a huge line " + strings.Repeat("x", 100000) + " 2015\n"
+	tests := []struct {
+		name    string
+		variant Variant
+		data    string
+	}{
+		{"mboxo", Mboxo, mboxWithOneMessage[:strings.Index(mboxWithOneMessage, "\n\n")+2] + large + "\n" + mboxWithThreeMessages},
+		{"mboxcl2", Mboxcl2, strings.Replace(mboxWithOneMessage[:strings.Index(mboxWithOneMessage, "\n\n")+2], "Subject: Test", fmt.Sprintf("Subject: Test\nContent-Length: %d", len(large)), 1) + large + "\n" + mboxWithThreeMessages},
+	}
+	for _, test := range tests {
+		src := &countingReader{r: strings.NewReader(test.data)}
+		m := NewScanner(src, false)
+		m.SetVariant(test.variant)
+		m.Buffer(nil, 4096)
+		if !m.Next() {
+			t.Fatalf("%s - Next() failed: %v", test.name, m.Err())
+		}
+		if src.n > 4096 {
+			t.Errorf("%s - read %d bytes before reading the body", test.name, src.n)
+		}
+		body := new(bytes.Buffer)
+		if _, err := body.ReadFrom(m.Message().Body); err != nil {
+			t.Fatalf("%s - Unexpected error reading message body: %v", test.name, err)
+		}
+		if body.String() != large {
+			t.Errorf("%s - Unexpected body of %d bytes", test.name, body.Len())
+		}
+		for i := 0; i < 3; i++ {
+			if !m.Next() {
+				t.Fatalf("%s - Next() failed; pass %d: %v", test.name, i, m.Err())
+			}
+		}
+		if m.Next() {
+			t.Errorf("%s - Next() succeeded", test.name)
+		}
+		if m.Err() != nil {
+			t.Errorf("%s - Unexpected error after Next(): %v", test.name, m.Err())
+		}
+	}
+}
+
+func TestScannerSkipsUnreadBody(t *testing.T) {
+	m := NewScanner(strings.NewReader(mboxWithThreeMessages), false)
+	subjects := []string{}
+	for m.Next() {
+		subjects = append(subjects, m.Message().Header.Get("Subject"))
+	}
+	if m.Err() != nil {
+		t.Fatalf("Unexpected error after Next(): %v", m.Err())
+	}
+	if strings.Join(subjects, ",") != "Test,Another test,A last test" {
+		t.Errorf("Unexpected subjects %q", subjects)
+	}
+}
+
+func TestScannerRawAfterRead(t *testing.T) {
+	m := NewScanner(strings.NewReader(mboxWithThreeMessages), false)
+	if !m.Next() {
+		t.Fatalf("Next() failed: %v", m.Err())
+	}
+	b := make([]byte, 10)
+	if _, err := m.Message().Body.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	if m.Raw() != nil {
+		t.Errorf("Raw() is not nil after reading from the body")
+	}
+}
+
+func TestScannerReadError(t *testing.T) {
+	readErr := errors.New("read error")
+	r := io.MultiReader(strings.NewReader(mboxWithOneMessage[:200]), iotest.ErrReader(readErr))
+	m := NewScanner(r, false)
+	if !m.Next() {
+		t.Fatalf("Next() failed: %v", m.Err())
+	}
+	if _, err := ioutil.ReadAll(m.Message().Body); err != readErr {
+		t.Errorf("Expected %v reading the body, got %v", readErr, err)
+	}
+	if m.Next() {
+		t.Errorf("Next() succeeded")
+	}
+	if m.Err() != readErr {
+		t.Errorf("Expected error %v after Next(), got %v", readErr, m.Err())
+	}
+}
+
 func TestHeaders(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -700,3 +1061,349 @@ Bye.
 	// Message from herp.derp at example.com (Herp Derp)
 	// Message from derp.herp at example.com (Derp Herp)
 }
+
+func TestScannerStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		mbox     string
+		variant  Variant
+		messages int
+		reason   Reason
+		offset   int64
+		line     int
+	}{
+		{
+			name:     "valid",
+			mbox:     mboxWithThreeMessages,
+			messages: 3,
+		},
+		{
+			name:   "leading garbage",
+			mbox:   "garbage\n" + mboxWithOneMessage,
+			reason: NoFromLine,
+			offset: 0,
+			line:   1,
+		},
+		{
+			name:   "trailing garbage",
+			mbox:   mboxWithOneMessage + "From garbage  Thu Jan  1 00:00:01 2015\n",
+			reason: InvalidHeader,
+			offset: int64(len(mboxWithOneMessage)),
+			line:   strings.Count(mboxWithOneMessage, "\n") + 1,
+		},
+		{
+			name:   "invalid header",
+			mbox:   "From herp.derp at example.com  Thu Jan  1 00:00:01 2015\nFrom: herp\nnot a header\n\nBody\n",
+			reason: InvalidHeader,
+			offset: 56,
+			line:   2,
+		},
+		{
+			name:   "truncated line",
+			mbox:   strings.TrimSuffix(mboxWithOneMessage, "\n\n"),
+			reason: TruncatedMessage,
+			offset: int64(len(mboxWithOneMessage) - 2),
+			line:   strings.Count(mboxWithOneMessage, "\n") - 1,
+		},
+		{
+			name:   "truncated header",
+			mbox:   "From herp.derp at example.com  Thu Jan  1 00:00:01 2015\nFrom: herp\nSubject: Test\n",
+			reason: TruncatedMessage,
+			offset: 81,
+			line:   4,
+		},
+		{
+			name:    "truncated body",
+			mbox:    mboxclMessages(len(mboxclFirstBody)+100, len(mboxclSecondBody))[:200],
+			variant: Mboxcl2,
+			reason:  TruncatedMessage,
+			offset:  172,
+			line:    7,
+		},
+		{
+			name:    "invalid content length",
+			mbox:    mboxclMessages(len(mboxclFirstBody)-3, len(mboxclSecondBody)),
+			variant: Mboxcl2,
+			reason:  InvalidContentLength,
+			offset:  int64(strings.Index(mboxclMessages(len(mboxclFirstBody)-3, len(mboxclSecondBody)), "\n\n") + 2),
+			line:    7,
+		},
+	}
+	for _, test := range tests {
+		m := NewScanner(strings.NewReader(test.mbox), false)
+		m.SetVariant(test.variant)
+		m.SetStrict(true)
+		n := 0
+		for m.Next() {
+			// an error reading the body is returned by Next as well
+			if _, err := ioutil.ReadAll(m.Message().Body); err == nil {
+				n++
+			}
+		}
+		if n != test.messages {
+			t.Errorf("%s: Expected %d messages, got %d", test.name, test.messages, n)
+		}
+		if test.reason == 0 {
+			if m.Err() != nil {
+				t.Errorf("%s: Unexpected error: %v", test.name, m.Err())
+			}
+			continue
+		}
+		var perr *ParseError
+		if !errors.As(m.Err(), &perr) {
+			t.Errorf("%s: Expected a *ParseError, got %v", test.name, m.Err())
+			continue
+		}
+		if !errors.Is(m.Err(), ErrInvalidMboxFormat) {
+			t.Errorf("%s: Expected %v to be ErrInvalidMboxFormat", test.name, m.Err())
+		}
+		if perr.Reason != test.reason || perr.Offset != test.offset || perr.Line != test.line {
+			t.Errorf("%s: Expected %v at offset %d, line %d, got %v at offset %d, line %d",
+				test.name, test.reason, test.offset, test.line, perr.Reason, perr.Offset, perr.Line)
+		}
+	}
+}
+
+func TestScannerLenient(t *testing.T) {
+	mbox := "garbage\n" + mboxWithOneMessage + "\nFrom garbage\n"
+	m := NewScanner(strings.NewReader(mbox), false)
+	n := 0
+	for m.Next() {
+		n++
+	}
+	if m.Err() != nil {
+		t.Errorf("Unexpected error: %v", m.Err())
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 message, got %d", n)
+	}
+}
+
+func TestScannerDiagnostics(t *testing.T) {
+	candidate := "From garbage  Thu Jan  1 00:00:01 2015\n"
+	mbox := "garbage\n" + mboxWithOneMessage + candidate + "\ntrailing garbage\n"
+	var got []Diagnostic
+	m := NewScanner(strings.NewReader(mbox), false)
+	m.SetDiagnostics(func(d Diagnostic) {
+		got = append(got, d)
+	})
+	n := 0
+	for m.Next() {
+		n++
+	}
+	if m.Err() != nil {
+		t.Errorf("Unexpected error: %v", m.Err())
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 message, got %d", n)
+	}
+
+	// the garbage following the rejected From_ line is part of the body
+	start := int64(len("garbage\n") + len(mboxWithOneMessage))
+	expected := []Diagnostic{
+		{Position: Position{0, 8}, Line: 1, Reason: NoFromLine},
+		{
+			Position: Position{start, start + int64(len(candidate))},
+			Line:     strings.Count(mboxWithOneMessage, "\n") + 2,
+			Reason:   InvalidHeader,
+		},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected diagnostics %v, got %v", expected, got)
+	}
+
+	// a message whose header cannot be parsed is skipped, unless it may
+	// be truncated at the end of the mbox
+	got = nil
+	m = NewScanner(strings.NewReader(mboxWithOneMessageMissingHeaders+"\n"+mboxWithOneMessage), false)
+	m.SetDiagnostics(func(d Diagnostic) {
+		got = append(got, d)
+	})
+	n = 0
+	for m.Next() {
+		if s := m.Message().Header.Get("Subject"); s != "Test" {
+			t.Errorf("Expected message %q, got %q", "Test", s)
+		}
+		n++
+	}
+	if m.Err() != nil || n != 1 {
+		t.Errorf("Expected 1 message, got %d and error %v", n, m.Err())
+	}
+	end := int64(len(mboxWithOneMessageMissingHeaders) + 1)
+	if len(got) != 1 || got[0].Position != (Position{0, end}) || got[0].Line != 1 || got[0].Reason != InvalidHeader || got[0].Err == nil {
+		t.Errorf("Expected an invalid header diagnostic at 0-%d, got %v", end, got)
+	}
+	got = nil
+	truncated := "From herp.derp at example.com  Thu Jan  1 00:00:01 2015\nFrom: herp.derp at example.com\nSubject: Test\nDat"
+	m = NewScanner(strings.NewReader(mboxWithOneMessage+truncated), false)
+	m.SetDiagnostics(func(d Diagnostic) {
+		got = append(got, d)
+	})
+	for m.Next() {
+	}
+	if m.Err() == nil || len(got) != 0 {
+		t.Errorf("Expected an error and no diagnostics, got %v and %v", m.Err(), got)
+	}
+
+	got = nil
+	m = NewScanner(strings.NewReader("trailing garbage\n"), false)
+	m.SetDiagnostics(func(d Diagnostic) {
+		got = append(got, d)
+	})
+	if m.Next() {
+		t.Errorf("Next() succeeded")
+	}
+	expected = []Diagnostic{{Position: Position{0, 17}, Line: 1, Reason: TrailingData}}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected diagnostics %v, got %v", expected, got)
+	}
+
+	got = nil
+	m = NewScanner(strings.NewReader(mboxclMessages(len(mboxclFirstBody)-3, len(mboxclSecondBody))), false)
+	m.SetVariant(Mboxcl2)
+	m.SetDiagnostics(func(d Diagnostic) {
+		got = append(got, d)
+	})
+	for m.Next() {
+	}
+	expected = []Diagnostic{{Position: Position{172, 172}, Line: 7, Reason: InvalidContentLength}}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected diagnostics %v, got %v", expected, got)
+	}
+}
+
+func TestScannerCRLF(t *testing.T) {
+	crlf := strings.Replace(mboxWithThreeMessages, "\n", "\r\n", -1)
+	// mixed line endings, as found in mboxes written by different programs
+	mixed := strings.Replace(mboxWithThreeMessages, "Bye.\n\nFrom", "Bye.\r\n\r\nFrom", -1)
+	for _, test := range []struct {
+		name, mbox, body string
+	}{
+		{"crlf", crlf, strings.Replace(mboxFirstMessageBody, "\n", "\r\n", -1)},
+		{"mixed", mixed, strings.Replace(mboxFirstMessageBody, "Bye.\n", "Bye.\r\n", -1)},
+	} {
+		m := NewScanner(strings.NewReader(test.mbox), false)
+		var subjects []string
+		for m.Next() {
+			msg := m.Message()
+			subjects = append(subjects, msg.Header.Get("Subject"))
+			b, err := ioutil.ReadAll(msg.Body)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if len(subjects) == 1 && string(b) != test.body {
+				t.Errorf("%s: Expected body %q, got %q", test.name, test.body, b)
+			}
+		}
+		if m.Err() != nil {
+			t.Errorf("%s: Unexpected error: %v", test.name, m.Err())
+		}
+		if expected := []string{"Test", "Another test", "A last test"}; fmt.Sprint(subjects) != fmt.Sprint(expected) {
+			t.Errorf("%s: Expected subjects %q, got %q", test.name, expected, subjects)
+		}
+	}
+
+	s := NewScanner(strings.NewReader(strings.Replace(mboxWithThreeMessagesHeaders, "\n", "\r\n", -1)), true)
+	n := 0
+	for s.Next() {
+		n++
+	}
+	if s.Err() != nil || n != 3 {
+		t.Errorf("Expected 3 headers, got %d (error %v)", n, s.Err())
+	}
+}
+
+const mboxWithThreeMessagesHeaders = `From: herp.derp at example.com (Herp Derp)
+Subject: Test
+
+
+From: derp.herp at example.com (Derp Herp)
+Subject: Another test
+
+
+From: bernd.lauert at example.com (Bernd Lauert)
+Subject: A last test
+
+
+`
+
+func TestScannerNextContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewScanner(strings.NewReader(mboxWithThreeMessages), false)
+	m.Buffer(nil, 256)
+	if !m.NextContext(ctx) {
+		t.Fatalf("NextContext() failed: %v", m.Err())
+	}
+	cancel()
+	if _, err := ioutil.ReadAll(m.Message().Body); err != context.Canceled {
+		t.Errorf("Expected %v reading the body, got %v", context.Canceled, err)
+	}
+	if m.NextContext(ctx) {
+		t.Errorf("NextContext() succeeded")
+	}
+	if m.Err() != context.Canceled {
+		t.Errorf("Expected error %v, got %v", context.Canceled, m.Err())
+	}
+
+	m = NewScanner(strings.NewReader(mboxWithThreeMessages), false)
+	if m.NextContext(ctx) {
+		t.Errorf("NextContext() succeeded with a canceled context")
+	}
+	if m.Err() != context.Canceled {
+		t.Errorf("Expected error %v, got %v", context.Canceled, m.Err())
+	}
+}
+
+func TestScannerProgress(t *testing.T) {
+	var got []Progress
+	m := NewScanner(strings.NewReader(mboxWithThreeMessages), false)
+	m.SetProgress(func(p Progress) {
+		got = append(got, p)
+	})
+	for m.Next() {
+	}
+	size := int64(len(mboxWithThreeMessages))
+	if len(got) != 4 {
+		t.Fatalf("Expected 4 reports, got %v", got)
+	}
+	for i, p := range got[:3] {
+		if p.Size != size || p.Messages != i+1 {
+			t.Errorf("Unexpected progress %+v after %d messages", p, i+1)
+		}
+		if i > 0 && p.Read <= got[i-1].Read {
+			t.Errorf("Progress %+v does not advance", p)
+		}
+	}
+	if last := got[3]; last.Read != size || last.Messages != 3 {
+		t.Errorf("Expected all of %d bytes and 3 messages read, got %+v", size, last)
+	}
+
+	// the size of other readers is not known
+	m = NewScanner(iotest.OneByteReader(strings.NewReader(mboxWithThreeMessages)), false)
+	m.SetProgress(func(p Progress) {
+		if p.Size != -1 {
+			t.Errorf("Expected an unknown size, got %d", p.Size)
+		}
+	})
+	for m.Next() {
+	}
+}
+
+func TestHeaderEnd(t *testing.T) {
+	for _, test := range []struct {
+		data string
+		end  int
+	}{
+		{"A: b\nC: d\n\nbody\n\n", 11},
+		{"A: b\r\nC: d\r\n\r\nbody\n\n", 14},
+		{"A: b\r\nC: d\n\r\nbody\n\n", 13},
+		{"A: b\nC: d\r\n\nbody\r\n\r\n", 12},
+		{"\nbody\n", -1},
+		{"A: b\nC: d\n", -1},
+		{"", -1},
+	} {
+		if e := headerEnd([]byte(test.data)); e != test.end {
+			t.Errorf("Expected the header of %q to end at %d, got %d", test.data, test.end, e)
+		}
+	}
+}
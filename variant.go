@@ -0,0 +1,86 @@
+package mbox
+
+import (
+	"regexp"
+)
+
+// Variant identifies one of the mutually incompatible flavours of the mbox
+// format. They differ in how lines starting with "From " inside a message are
+// kept from being mistaken for message separators.
+type Variant int
+
+const (
+	// Mboxo escapes lines starting with "From " by prepending a '>'. The
+	// escaping is ambiguous and thus never reverted when reading.
+	Mboxo Variant = iota
+
+	// Mboxrd escapes every line matching ">*From " by prepending a '>'.
+	// Readers remove exactly one '>' from such lines, so messages survive
+	// any number of read/write cycles unchanged.
+	Mboxrd
+
+	// Mboxcl escapes like Mboxo, but additionally records the length of
+	// each message body in a Content-Length header, which readers use to
+	// find the end of a message.
+	Mboxcl
+
+	// Mboxcl2 does not escape "From " lines at all and relies solely on the
+	// Content-Length header to find the end of a message.
+	Mboxcl2
+
+	// MMDF is not an mbox variant, but the format of the Multichannel
+	// Memorandum Distribution Facility. Messages have no From_ line and are
+	// enclosed by lines of four Control-A characters instead, so "From "
+	// lines are not escaped. A line of the body equal to the delimiter is
+	// escaped by prepending a '>', which is never reverted when reading.
+	MMDF
+)
+
+// Auto is not a variant of its own. It makes a Scanner detect the variant from
+// the start of the mbox, see Detect.
+const Auto Variant = -1
+
+var variantNames = map[Variant]string{
+	Auto:    "auto",
+	Mboxo:   "mboxo",
+	Mboxrd:  "mboxrd",
+	Mboxcl:  "mboxcl",
+	Mboxcl2: "mboxcl2",
+	MMDF:    "mmdf",
+}
+
+// contentLength reports whether variant v delimits messages by their
+// Content-Length header.
+func (v Variant) contentLength() bool {
+	return v == Mboxcl || v == Mboxcl2
+}
+
+// escapes reports whether variant v escapes lines inside messages, and returns
+// the start of the lines to escape. For MMDF only lines equal to the delimiter
+// are escaped.
+func (v Variant) escapes() (bool, string) {
+	switch v {
+	case Mboxcl2:
+		return false, "From "
+	case MMDF:
+		return true, mmdfDelimiter
+	}
+	return true, "From "
+}
+
+func (v Variant) String() string {
+	if s, ok := variantNames[v]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+var mboxrdUnescape = regexp.MustCompile(`(?m)^>(>*From )`)
+
+// unescapeMessage reverts the escaping of "From " lines applied by variant v.
+func unescapeMessage(b []byte, v Variant) []byte {
+	if v == Mboxrd {
+		return mboxrdUnescape.ReplaceAll(b, []byte("$1"))
+	}
+	return b
+}
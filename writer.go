@@ -7,84 +7,469 @@
 package mbox
 
 import (
+	"bufio"
+	"bytes"
 	"io"
 	"io/ioutil"
 	"net/mail"
 	"net/textproto"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/mzimmerman/mbox/internal/mailheader"
 )
 
-// Write a MIME header.
-func writeMIMEHeader(w io.Writer, header textproto.MIMEHeader) (N int, err error) {
-	var n int
+// LineEnding is the line ending written by a Writer.
+type LineEnding int
 
-	for name, values := range header {
-		for _, value := range values {
-			n, err = io.WriteString(w, name+": "+value+"\r\n")
-			N += n
-			if err != nil {
-				return
-			}
-		}
+const (
+	// CRLF ends lines with "\r\n", as in RFC 5322.
+	CRLF LineEnding = iota
+
+	// LF ends lines with "\n", as is common for mboxes on Unix.
+	LF
+)
+
+func (e LineEnding) String() string {
+	if e == LF {
+		return "\n"
 	}
+	return "\r\n"
+}
 
-	n, err = io.WriteString(w, "\r\n")
-	N += n
-	return
+// Write a MIME header. The fields named in order are written first, in that
+// order, followed by the remaining fields sorted by name.
+func writeMIMEHeader(w io.Writer, header textproto.MIMEHeader, order []string, newline string) (N int, err error) {
+	return mailheader.Write(w, header, order, newline)
+}
+
+// headerOrder returns the canonical names of the fields of header, in the
+// order they appear.
+func headerOrder(header []byte) []string {
+	var order []string
+	for len(header) > 0 {
+		line := header
+		if e := bytes.IndexByte(header, '\n'); e != -1 {
+			line, header = header[:e], header[e+1:]
+		} else {
+			header = nil
+		}
+		if name := mailheader.FieldName(line); name != "" {
+			order = append(order, name)
+		}
+	}
+	return order
 }
 
 // Writer writes messages to a mbox stream.
 type Writer struct {
-	w io.Writer
+	w       *bufio.Writer
+	variant Variant
+	newline LineEnding
+	now     func() time.Time
+	c       io.Closer // compressor finished by Close
+	partial bool      // whether WriteVerbatim left the last line unterminated
 }
 
 // NewWriter creates a new *Writer that writes messages to w.
 func NewWriter(w io.Writer) *Writer {
-	return &Writer{w}
+	return &Writer{w: bufio.NewWriter(w), now: time.Now}
 }
 
-// WriteMessage writes a message to the mbox stream. It returns the number of
-// bytes written.
+// Close flushes w and finishes the compressed data of a Writer created by
+// NewCompressedWriter. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if w.c != nil {
+		return w.c.Close()
+	}
+	return nil
+}
+
+// SetVariant sets the mbox variant used to escape "From " lines inside
+// messages. For Mboxcl and Mboxcl2 a Content-Length header is written
+// instead of the one of the message, if any. For MMDF messages are enclosed by
+// delimiter lines instead of following a From_ line, and delimiter lines inside
+// a message are escaped. The default is Mboxo.
+//
+// "From " lines are escaped while the body is copied, so messages of any size
+// are written with bounded memory. For Mboxcl and Mboxcl2 this requires the
+// Body of a message to implement io.Seeker, otherwise the escaped body is read
+// into memory to determine its length.
+func (w *Writer) SetVariant(v Variant) {
+	w.variant = v
+}
+
+// SetLineEnding sets the line ending written for the From_ line, the header
+// and the body of every message. Line endings of the body are converted. The
+// default is CRLF.
+func (w *Writer) SetLineEnding(e LineEnding) {
+	w.newline = e
+}
+
+// SetClock sets the function returning the current time, which is used for the
+// From_ line of messages without a date. The default is time.Now.
+func (w *Writer) SetClock(now func() time.Time) {
+	w.now = now
+}
+
+// envelopeDate returns the time of delivery of a message with header h. It is
+// taken from the topmost Received header, the one added last, or from the Date
+// header, and defaults to now.
+func envelopeDate(h mail.Header, now func() time.Time) time.Time {
+	if received := h["Received"]; len(received) > 0 {
+		if i := strings.LastIndexByte(received[0], ';'); i != -1 {
+			if t, err := mail.ParseDate(strings.TrimSpace(received[0][i+1:])); err == nil {
+				return t
+			}
+		}
+	}
+	if t, err := h.Date(); err == nil {
+		return t
+	}
+	return now()
+}
+
+// envelopeLine returns the From_ line for a message with header h, see
+// WriteMessageEnvelope.
+func (w *Writer) envelopeLine(h mail.Header, env *Envelope) string {
+	if keepsRaw(env) {
+		return env.Raw
+	}
+	e := Envelope{}
+	if env != nil {
+		e.Sender, e.Date = env.Sender, env.Date
+	}
+	if e.Sender == "" {
+		e.Sender = mailheader.Sender(h)
+	}
+	if e.Date.IsZero() {
+		e.Date = envelopeDate(h, w.now).UTC()
+	}
+	return e.String()
+}
+
+// keepsRaw reports whether envelopeLine writes the Raw line of env, which has to
+// be a From_ line recognized by a Scanner.
+func keepsRaw(env *Envelope) bool {
+	return env != nil && env.Raw != "" && isFromLine([]byte(env.Raw))
+}
+
+// synthesizes reports whether envelopeLine synthesizes a part of the From_ line
+// from the header of a message with envelope env.
+func synthesizes(env *Envelope) bool {
+	return !keepsRaw(env) && (env == nil || env.Sender == "" || env.Date.IsZero())
+}
+
+// WriteMessage writes a message to the mbox stream. Its From_ line is
+// synthesized from the headers of the message: the sender is taken from the
+// Return-Path, Sender or From header and defaults to MAILER-DAEMON, the date is
+// taken from the topmost Received header or the Date header and defaults to the
+// current time. The date is written in UTC. It returns the number of bytes
+// written.
 func (w *Writer) WriteMessage(m *mail.Message) (N int, err error) {
-	from := "???@???"
-	if fromList, err := m.Header.AddressList("From"); err == nil && len(fromList) > 0 {
-		from = fromList[0].Address
+	return w.WriteMessageEnvelope(m, nil)
+}
+
+// WriteMessageEnvelope writes a message to the mbox stream, using env as its
+// From_ line. The Raw line of env is written unchanged if it is set and a
+// Scanner recognizes it as a From_ line, otherwise the line is formatted from
+// Sender and Date. An empty Sender or a zero Date, as returned by ParseEnvelope
+// for a line it cannot parse, is synthesized from the header like by
+// WriteMessage. If env is nil, WriteMessageEnvelope behaves like WriteMessage.
+// It returns the number of bytes written.
+//
+// Header fields are written in the order they were read if m was returned by
+// a Scanner, a ParallelScanner or a Follower, and sorted by name otherwise.
+// The last line of the body is terminated if necessary and followed by an
+// empty line. If reading the body fails, the message may have been written
+// partially.
+//
+// For MMDF, env is ignored: the message is written without a From_ line,
+// enclosed by delimiter lines.
+func (w *Writer) WriteMessageEnvelope(m *mail.Message, env *Envelope) (N int, err error) {
+	defer func() {
+		if ferr := w.w.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+	if N, err = w.endLine(); err != nil {
+		return
 	}
 
-	date := ""
-	if t, err := m.Header.Date(); err == nil {
-		date = t.Format(time.ANSIC)
+	line := mmdfDelimiter
+	if w.variant != MMDF {
+		line = w.envelopeLine(m.Header, env)
+	}
+
+	var order []string
+	switch b := m.Body.(type) {
+	case *body:
+		order = b.order
+	case *memoryBody:
+		order = b.order
+	}
+	newline := w.newline.String()
+
+	// The Content-Length header precedes the body, so the length of the
+	// escaped body has to be known in advance. It is measured in a first
+	// pass if the body can be rewound, otherwise the escaped body is kept
+	// in memory.
+	header := textproto.MIMEHeader(m.Header)
+	var escaped *bytes.Buffer
+	if w.variant.contentLength() {
+		var length int64
+		if s, ok := m.Body.(io.Seeker); ok {
+			var start int64
+			if start, err = s.Seek(0, io.SeekCurrent); err != nil {
+				return
+			}
+			if length, err = escapeBody(ioutil.Discard, m.Body, w.variant, newline, false); err != nil {
+				return
+			}
+			if _, err = s.Seek(start, io.SeekStart); err != nil {
+				return
+			}
+		} else {
+			escaped = &bytes.Buffer{}
+			if length, err = escapeBody(escaped, m.Body, w.variant, newline, false); err != nil {
+				return
+			}
+		}
+
+		header = make(textproto.MIMEHeader, len(m.Header)+1)
+		for k, v := range m.Header {
+			header[k] = v
+		}
+		header.Set("Content-Length", strconv.FormatInt(length, 10))
 	}
 
-	line := "From " + from + " " + date + "\r\n"
-	n, err := io.WriteString(w.w, line)
+	n, err := io.WriteString(w.w, line+newline)
 	N += n
 	if err != nil {
 		return
 	}
 
-	n, err = writeMIMEHeader(w.w, textproto.MIMEHeader(m.Header))
+	n, err = writeMIMEHeader(w.w, header, order, newline)
 	N += n
 	if err != nil {
 		return
 	}
 
-	// Escape lines begining with "From "
-	// TODO: use golang.org/x/text/transform
-	b, err := ioutil.ReadAll(m.Body)
+	var nb int64
+	if escaped != nil {
+		nb, err = escaped.WriteTo(w.w)
+	} else {
+		nb, err = escapeBody(w.w, m.Body, w.variant, newline, false)
+	}
+	N += int(nb)
 	if err != nil {
 		return
 	}
 
-	r := strings.NewReplacer("\nFrom ", "\n>From ")
-	n, err = r.WriteString(w.w, string(b))
+	if w.variant == MMDF {
+		n, err = io.WriteString(w.w, mmdfDelimiter+newline)
+	} else {
+		n, err = io.WriteString(w.w, newline)
+	}
+	N += n
+	return
+}
+
+// escapeBody copies the body r to dst, escaping "From " lines for variant v and
+// ending lines with newline. If keep is true, line endings are kept and
+// newline is only used to terminate the last line. It returns the number of
+// bytes written to dst.
+func escapeBody(dst io.Writer, r io.Reader, v Variant, newline string, keep bool) (int64, error) {
+	e := newEscaper(dst, v, newline)
+	e.keep = keep
+	if _, err := io.Copy(e, r); err != nil {
+		return e.n, err
+	}
+	err := e.Close()
+	return e.n, err
+}
+
+// WriteRaw writes the message raw, given in RFC 5322 format, to the mbox
+// stream, using env as its From_ line like WriteMessageEnvelope. Unlike
+// WriteMessageEnvelope it writes the header and the body as they are, keeping
+// the order, folding and case of header fields as well as line endings. Only
+// "From " lines are escaped for the variant of w, and for Mboxcl and Mboxcl2 a
+// wrong or missing Content-Length header is corrected. If env is nil or lacks
+// the Sender or Date, the From_ line is synthesized from the header of raw. For
+// MMDF, env is ignored like by WriteMessageEnvelope.
+//
+// The From_ line and the empty line following the message end like the lines
+// of raw. An mbox read by a Scanner is copied by
+//
+//	for m.Next() {
+//		body, _ := ioutil.ReadAll(m.Message().Body)
+//		w.WriteRaw(append(m.RawHeader(), body...), m.Envelope())
+//	}
+//
+// The copy equals the original unless a body contains a "From " line that was
+// left unescaped, which a Scanner accepts if it is not followed by a valid
+// header, but WriteRaw escapes. To copy messages byte for byte, use
+// WriteVerbatim.
+//
+// It returns the number of bytes written.
+func (w *Writer) WriteRaw(raw []byte, env *Envelope) (N int, err error) {
+	defer func() {
+		if ferr := w.w.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+	if N, err = w.endLine(); err != nil {
+		return
+	}
+
+	newline := w.newline.String()
+	if e := bytes.IndexByte(raw, '\n'); e != -1 {
+		newline = string(lineEnding(raw[:e+1]))
+	}
+
+	line := mmdfDelimiter
+	if w.variant != MMDF {
+		var h mail.Header
+		if synthesizes(env) {
+			var m *mail.Message
+			if m, err = mail.ReadMessage(bytes.NewReader(raw)); err != nil {
+				return
+			}
+			h = m.Header
+		}
+		line = w.envelopeLine(h, env)
+	}
+
+	h := headerEnd(raw)
+	if h == -1 {
+		h = len(raw)
+	}
+	header, body := raw[:h], raw[h:]
+	if w.variant.contentLength() {
+		length, _ := escapeBody(ioutil.Discard, bytes.NewReader(body), w.variant, newline, true)
+		header = setContentLength(header, length, newline)
+	}
+
+	n, err := io.WriteString(w.w, line+newline)
 	N += n
 	if err != nil {
 		return
 	}
 
-	n, err = io.WriteString(w.w, "\r\n\r\n")
+	n, err = w.w.Write(header)
 	N += n
+	if err != nil {
+		return
+	}
+
+	nb, err := escapeBody(w.w, bytes.NewReader(body), w.variant, newline, true)
+	N += int(nb)
+	if err != nil {
+		return
+	}
+
+	if e := lineEnding(body); e != nil {
+		newline = string(e)
+	}
+	if w.variant == MMDF {
+		n, err = io.WriteString(w.w, mmdfDelimiter+newline)
+	} else {
+		n, err = io.WriteString(w.w, newline)
+	}
+	N += n
+	return
+}
+
+// WriteVerbatim writes raw, a message as found in an mbox of the variant of w,
+// unchanged to the mbox stream. raw has to start with a From_ line, or with a
+// delimiter line for MMDF, otherwise ErrInvalidMboxFormat is returned. An mbox
+// read by a Scanner is copied byte for byte by
+//
+//	for m.Next() {
+//		w.WriteVerbatim(m.Raw())
+//	}
+//
+// Nothing is escaped or converted, so raw has to be read with the variant of
+// w. If raw does not end with a line ending, one is written before the next
+// message. It returns the number of bytes written.
+func (w *Writer) WriteVerbatim(raw []byte) (N int, err error) {
+	defer func() {
+		if ferr := w.w.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+
+	line := raw
+	if e := bytes.IndexByte(raw, '\n'); e != -1 {
+		line = raw[:e+1]
+	}
+	if w.variant == MMDF && !isMMDFDelimiter(line) ||
+		w.variant != MMDF && !isFromLine(bytes.TrimSuffix(line, []byte("\n"))) {
+		return 0, ErrInvalidMboxFormat
+	}
+	if N, err = w.endLine(); err != nil {
+		return
+	}
+	n, err := w.w.Write(raw)
+	N += n
+	w.partial = lineEnding(raw) == nil
 	return
 }
+
+// endLine terminates the last line written by WriteVerbatim if necessary, so
+// that the next message starts on a line of its own.
+func (w *Writer) endLine() (int, error) {
+	if !w.partial {
+		return 0, nil
+	}
+	w.partial = false
+	return io.WriteString(w.w, w.newline.String())
+}
+
+// lineEnding returns the line ending b ends with, or nil if it does not end
+// with a line ending.
+func lineEnding(b []byte) []byte {
+	switch {
+	case bytes.HasSuffix(b, []byte("\r\n")):
+		return b[len(b)-2:]
+	case bytes.HasSuffix(b, []byte("\n")):
+		return b[len(b)-1:]
+	}
+	return nil
+}
+
+// setContentLength returns the raw header with its Content-Length field set to
+// length. The field is added before the end of the header if it is missing.
+func setContentLength(header []byte, length int64, newline string) []byte {
+	value := strconv.FormatInt(length, 10)
+	for pos := 0; pos < len(header); {
+		e := bytes.IndexByte(header[pos:], '\n')
+		if e == -1 {
+			break
+		}
+		line := header[pos : pos+e+1]
+		i := bytes.IndexByte(line, ':')
+		if i > 0 && textproto.CanonicalMIMEHeaderKey(string(bytes.TrimRight(line[:i], " \t"))) == "Content-Length" {
+			if string(bytes.TrimSpace(line[i+1:])) == value {
+				return header
+			}
+			out := append([]byte{}, header[:pos+i+1]...)
+			out = append(append(out, " "+value...), lineEnding(line)...)
+			return append(out, header[pos+e+1:]...)
+		}
+		pos += e + 1
+	}
+
+	at := len(header)
+	if e := lineEnding(header); e != nil && isEmptyLine(header[bytes.LastIndexByte(header[:at-1], '\n')+1:]) {
+		// insert before the empty line ending the header
+		at -= len(e)
+	}
+	out := append([]byte{}, header[:at]...)
+	out = append(out, "Content-Length: "+value+newline...)
+	return append(out, header[at:]...)
+}
@@ -2,14 +2,28 @@ package mbox
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
 	"net/mail"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func testWriter(t *testing.T, messages []*mail.Message) string {
+	return testWriterVariant(t, Mboxo, messages)
+}
+
+func testWriterVariant(t *testing.T, v Variant, messages []*mail.Message) string {
 	b := &bytes.Buffer{}
 	w := NewWriter(b)
+	w.SetVariant(v)
+	w.SetClock(func() time.Time {
+		return time.Date(2015, 1, 1, 0, 0, 1, 0, time.UTC)
+	})
 
 	for _, m := range messages {
 		if _, err := w.WriteMessage(m); err != nil {
@@ -46,30 +60,569 @@ Bye.`),
 		},
 	}
 
-	expected := `From ???@??? Thu Jan  1 00:00:01 2015` + "\r" + `
-Date: Thu, 01 Jan 2015 00:00:01 +0100` + "\r" + `
-` + "\r" + `
+	expected := strings.Replace(`From MAILER-DAEMON Wed Dec 31 23:00:01 2014
+Date: Thu, 01 Jan 2015 00:00:01 +0100
+
 This is a simple test.
 
 And, by the way, this is how a "From" line is escaped in mboxo format:
 
 >From Herp Derp with love.
 
-Bye.` + "\r" + `
-` + "\r" + `
-From ???@??? Fri Jan  2 00:00:01 2015` + "\r" + `
-Date: Thu, 02 Jan 2015 00:00:01 +0100` + "\r" + `
-` + "\r" + `
+Bye.
+
+From MAILER-DAEMON Thu Jan  1 23:00:01 2015
+Date: Thu, 02 Jan 2015 00:00:01 +0100
+
 This is another simple test.
 
 Another line.
 
-Bye.` + "\r" + `
-` + "\r" + `
-`
+Bye.
+
+`, "\n", "\r\n", -1)
 
 	s := testWriter(t, messages)
 	if s != expected {
 		t.Error("Invalid mbox output:", s)
 	}
 }
+
+func TestWriterMboxrd(t *testing.T) {
+	messages := []*mail.Message{
+		&mail.Message{
+			Header: map[string][]string{
+				"Date": {"Thu, 01 Jan 2015 00:00:01 +0100"},
+			},
+			Body: strings.NewReader(mboxrdUnescapedBody),
+		},
+	}
+
+	expected := strings.Replace(`From MAILER-DAEMON Wed Dec 31 23:00:01 2014
+Date: Thu, 01 Jan 2015 00:00:01 +0100
+
+`+mboxrdWithEscapedFroms[strings.Index(mboxrdWithEscapedFroms, "\n\n")+2:], "\n", "\r\n", -1)
+
+	s := testWriterVariant(t, Mboxrd, messages)
+	if s != expected {
+		t.Errorf("Invalid mbox output:\n%q\nexpected:\n%q", s, expected)
+	}
+}
+
+func TestMboxrdRoundTrip(t *testing.T) {
+	body := mboxrdWithEscapedFroms[strings.Index(mboxrdWithEscapedFroms, "\n\n")+2 : len(mboxrdWithEscapedFroms)-1]
+	for i := 0; i < 3; i++ {
+		m := NewScanner(strings.NewReader("From MAILER-DAEMON Thu Jan  1 00:00:01 2015\nSubject: Test\nDate: Thu, 01 Jan 2015 00:00:01 +0100\n\n"+body+"\n"), false)
+		m.SetVariant(Mboxrd)
+		if !m.Next() {
+			t.Fatalf("pass %d - Next() failed: %v", i, m.Err())
+		}
+		b := &bytes.Buffer{}
+		if _, err := b.ReadFrom(m.Message().Body); err != nil {
+			t.Fatal(err)
+		}
+		out := &bytes.Buffer{}
+		w := NewWriter(out)
+		w.SetVariant(Mboxrd)
+		w.SetLineEnding(LF)
+		if _, err := w.WriteMessage(&mail.Message{Header: m.Message().Header, Body: b}); err != nil {
+			t.Fatal(err)
+		}
+		s := out.String()
+		got := s[strings.Index(s, "\n\n")+2 : len(s)-1]
+		if got != body {
+			t.Fatalf("pass %d - body changed:\n%q\nexpected:\n%q", i, got, body)
+		}
+	}
+}
+
+func TestWriterContentLength(t *testing.T) {
+	body := "This is a simple test.\n\nFrom Herp Derp with love.\n\nBye.\n"
+	tests := []struct {
+		variant Variant
+		body    string
+	}{
+		{Mboxcl, strings.Replace(body, "\nFrom ", "\n>From ", -1)},
+		{Mboxcl2, body},
+	}
+	for _, test := range tests {
+		messages := []*mail.Message{
+			&mail.Message{
+				Header: map[string][]string{
+					"Content-Length": {"1"},
+				},
+				Body: strings.NewReader(body),
+			},
+		}
+
+		crlfBody := strings.Replace(test.body, "\n", "\r\n", -1)
+		expected := "From MAILER-DAEMON Thu Jan  1 00:00:01 2015\r\n" +
+			"Content-Length: " + strconv.Itoa(len(crlfBody)) + "\r\n" +
+			"\r\n" +
+			crlfBody +
+			"\r\n"
+
+		s := testWriterVariant(t, test.variant, messages)
+		if s != expected {
+			t.Errorf("%v - Invalid mbox output:\n%q\nexpected:\n%q", test.variant, s, expected)
+		}
+		if messages[0].Header.Get("Content-Length") != "1" {
+			t.Errorf("%v - message header was modified", test.variant)
+		}
+	}
+}
+
+func TestWriterEnvelope(t *testing.T) {
+	tests := []struct {
+		envelope *Envelope
+		line     string
+	}{
+		{
+			envelope: nil,
+			line:     "From herp.derp@example.com Thu Jan  1 00:00:01 2015",
+		},
+		{
+			envelope: &Envelope{Sender: "derp.herp@example.com", Date: time.Date(2015, 1, 2, 0, 0, 1, 0, time.UTC)},
+			line:     "From derp.herp@example.com Fri Jan  2 00:00:01 2015",
+		},
+		{
+			envelope: &Envelope{
+				Sender: "derp.herp@example.com",
+				Date:   time.Date(2015, 1, 2, 0, 0, 1, 0, time.UTC),
+				Raw:    "From derp.herp@example.com  Fri Jan  2 00:00:01 2015 remote from example",
+			},
+			line: "From derp.herp@example.com  Fri Jan  2 00:00:01 2015 remote from example",
+		},
+	}
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		w := NewWriter(b)
+		m := &mail.Message{
+			Header: map[string][]string{
+				"From": {"Herp Derp <herp.derp@example.com>"},
+				"Date": {"Thu, 01 Jan 2015 00:00:01 +0000"},
+			},
+			Body: strings.NewReader("Test.\n"),
+		}
+		if _, err := w.WriteMessageEnvelope(m, test.envelope); err != nil {
+			t.Fatal(err)
+		}
+		if line := b.String()[:strings.Index(b.String(), "\r\n")]; line != test.line {
+			t.Errorf("Expected From_ line %q, got %q", test.line, line)
+		}
+	}
+}
+
+func TestWriterScannerRoundTrip(t *testing.T) {
+	bodies := []string{"This is a simple test.\n\nWith love from Herp Derp.\n\nBye.", "Another test.\r\n"}
+	for _, v := range []Variant{Mboxo, Mboxrd, Mboxcl, Mboxcl2} {
+		for _, e := range []LineEnding{CRLF, LF} {
+			var messages []*mail.Message
+			for i, body := range bodies {
+				messages = append(messages, &mail.Message{
+					Header: map[string][]string{
+						"Date":    {"Thu, 01 Jan 2015 00:00:01 +0100"},
+						"Subject": {strconv.Itoa(i)},
+					},
+					Body: strings.NewReader(body),
+				})
+			}
+
+			b := &bytes.Buffer{}
+			w := NewWriter(b)
+			w.SetVariant(v)
+			w.SetLineEnding(e)
+			for _, m := range messages {
+				if _, err := w.WriteMessage(m); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m := NewScanner(b, false)
+			m.SetVariant(v)
+			i := 0
+			for ; m.Next(); i++ {
+				msg := m.Message()
+				if i >= len(bodies) {
+					continue
+				}
+				if got := msg.Header.Get("Subject"); got != strconv.Itoa(i) {
+					t.Errorf("%v %q: Expected subject %d, got %q", v, e, i, got)
+				}
+				got, err := ioutil.ReadAll(msg.Body)
+				if err != nil {
+					t.Fatalf("%v %q: %v", v, e, err)
+				}
+				// the Writer terminates the last line of the body
+				expected := strings.Replace(strings.TrimSuffix(bodies[i], "\r\n"), "\n", e.String(), -1) + e.String()
+				if string(got) != expected {
+					t.Errorf("%v %q: Expected body %q, got %q", v, e, expected, got)
+				}
+			}
+			if m.Err() != nil {
+				t.Errorf("%v %q: Unexpected error: %v", v, e, m.Err())
+			}
+			if i != len(bodies) {
+				t.Errorf("%v %q: Expected %d messages, got %d", v, e, len(bodies), i)
+			}
+		}
+	}
+}
+
+func TestWriterHeaderOrder(t *testing.T) {
+	header := "Subject: Test\nX-Mailer: Herp\nFrom: herp.derp@example.com\nX-Mailer: Derp\nDate: Thu, 01 Jan 2015 00:00:01 +0100\n"
+	m := NewScanner(strings.NewReader("From herp.derp@example.com Thu Jan  1 00:00:01 2015\n"+header+"\nTest.\n"), false)
+	if !m.Next() {
+		t.Fatalf("Next() failed: %v", m.Err())
+	}
+	b := &bytes.Buffer{}
+	w := NewWriter(b)
+	w.SetLineEnding(LF)
+	if _, err := w.WriteMessageEnvelope(m.Message(), m.Envelope()); err != nil {
+		t.Fatal(err)
+	}
+	expected := "From herp.derp@example.com Thu Jan  1 00:00:01 2015\n" + header + "\nTest.\n\n"
+	if b.String() != expected {
+		t.Errorf("Invalid mbox output:\n%q\nexpected:\n%q", b.String(), expected)
+	}
+
+	// messages not read by a Scanner are written in a stable order
+	b.Reset()
+	if _, err := w.WriteMessage(&mail.Message{
+		Header: map[string][]string{
+			"Subject": {"Test"},
+			"From":    {"herp.derp@example.com"},
+			"Date":    {"Thu, 01 Jan 2015 00:00:01 +0100"},
+		},
+		Body: strings.NewReader("Test.\n"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expected = "From herp.derp@example.com Wed Dec 31 23:00:01 2014\n" +
+		"Date: Thu, 01 Jan 2015 00:00:01 +0100\nFrom: herp.derp@example.com\nSubject: Test\n\nTest.\n\n"
+	if b.String() != expected {
+		t.Errorf("Invalid mbox output:\n%q\nexpected:\n%q", b.String(), expected)
+	}
+}
+
+func TestWriterStreamsBody(t *testing.T) {
+	body := "From the start.\nThis is a simple test.\n"
+	for _, v := range []Variant{Mboxo, Mboxcl} {
+		var outputs []string
+		// the body of the second message cannot be rewound
+		for _, r := range []io.Reader{strings.NewReader(body), iotest.OneByteReader(strings.NewReader(body))} {
+			b := &bytes.Buffer{}
+			w := NewWriter(b)
+			w.SetVariant(v)
+			w.SetLineEnding(LF)
+			if _, err := w.WriteMessageEnvelope(&mail.Message{Header: map[string][]string{}, Body: r}, &Envelope{Raw: "From MAILER-DAEMON Thu Jan  1 00:00:01 2015"}); err != nil {
+				t.Fatal(err)
+			}
+			outputs = append(outputs, b.String())
+		}
+		expected := "From MAILER-DAEMON Thu Jan  1 00:00:01 2015\n\n>" + body + "\n"
+		if v == Mboxcl {
+			expected = "From MAILER-DAEMON Thu Jan  1 00:00:01 2015\nContent-Length: 40\n\n>" + body + "\n"
+		}
+		for _, s := range outputs {
+			if s != expected {
+				t.Errorf("%v: Invalid mbox output:\n%q\nexpected:\n%q", v, s, expected)
+			}
+		}
+	}
+
+	// a large body is not read into memory
+	const size = 32 << 20
+	line := strings.Repeat("x", 79) + "\n"
+	r := io.LimitReader(&repeatReader{s: line}, size)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	w := NewWriter(ioutil.Discard)
+	n, err := w.WriteMessage(&mail.Message{Header: map[string][]string{}, Body: r})
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < size {
+		t.Errorf("Expected more than %d bytes written, got %d", size, n)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > size/4 {
+		t.Errorf("Writing %d bytes allocated %d bytes", size, alloc)
+	}
+}
+
+// repeatReader returns s over and over.
+type repeatReader struct {
+	s   string
+	pos int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.s[r.pos:])
+		n += c
+		r.pos = (r.pos + c) % len(r.s)
+	}
+	return n, nil
+}
+
+func TestWriteRawRoundTrip(t *testing.T) {
+	tests := []struct {
+		variant Variant
+		mbox    string
+	}{
+		{Mboxo, mboxWithThreeMessages + "\n"},
+		{Mboxo, strings.Replace(mboxWithThreeMessages+"\n", "\n", "\r\n", -1)},
+		{Mboxrd, mboxrdWithEscapedFroms},
+		{Mboxcl2, mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody))},
+	}
+	for _, test := range tests {
+		m := NewScanner(strings.NewReader(test.mbox), false)
+		m.SetVariant(test.variant)
+		b := &bytes.Buffer{}
+		w := NewWriter(b)
+		w.SetVariant(test.variant)
+		for m.Next() {
+			body, err := ioutil.ReadAll(m.Message().Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.WriteRaw(append(m.RawHeader(), body...), m.Envelope()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if m.Err() != nil {
+			t.Fatal(m.Err())
+		}
+		if b.String() != test.mbox {
+			t.Errorf("%v: mbox changed:\n%q\nexpected:\n%q", test.variant, b.String(), test.mbox)
+		}
+	}
+}
+
+func TestWriteRawContentLength(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{
+			raw:      "Subject: Test\nContent-length:  1\n\nFrom Herp.\n",
+			expected: "Subject: Test\nContent-length: 12\n\n>From Herp.\n",
+		},
+		{
+			raw:      "Subject: Test\r\n\r\nBye.",
+			expected: "Subject: Test\r\nContent-Length: 6\r\n\r\nBye.\r\n",
+		},
+	}
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		w := NewWriter(b)
+		w.SetVariant(Mboxcl)
+		if _, err := w.WriteRaw([]byte(test.raw), &Envelope{Raw: "From MAILER-DAEMON Thu Jan  1 00:00:01 2015"}); err != nil {
+			t.Fatal(err)
+		}
+		line := "From MAILER-DAEMON Thu Jan  1 00:00:01 2015"
+		newline := test.raw[strings.Index(test.raw, "Test")+4 : strings.Index(test.raw, "Test")+5]
+		if newline == "\r" {
+			newline = "\r\n"
+		}
+		if expected := line + newline + test.expected + newline; b.String() != expected {
+			t.Errorf("Invalid mbox output:\n%q\nexpected:\n%q", b.String(), expected)
+		}
+	}
+}
+
+func TestWriterSynthesizeEnvelope(t *testing.T) {
+	now := time.Date(2015, 1, 3, 0, 0, 1, 0, time.UTC)
+	tests := []struct {
+		header map[string][]string
+		line   string
+	}{
+		{
+			header: map[string][]string{},
+			line:   "From MAILER-DAEMON Sat Jan  3 00:00:01 2015",
+		},
+		{
+			header: map[string][]string{
+				"Return-Path": {"<bounce@example.com>"},
+				"Sender":      {"list@example.com"},
+				"From":        {"Herp Derp <herp.derp@example.com>"},
+			},
+			line: "From bounce@example.com Sat Jan  3 00:00:01 2015",
+		},
+		{
+			header: map[string][]string{
+				"Return-Path": {"<>"},
+				"Sender":      {"list@example.com"},
+				"From":        {"Herp Derp <herp.derp@example.com>"},
+			},
+			line: "From list@example.com Sat Jan  3 00:00:01 2015",
+		},
+		{
+			header: map[string][]string{
+				"From": {"not an address"},
+				"Date": {"Thu, 01 Jan 2015 00:00:01 +0100"},
+			},
+			line: "From MAILER-DAEMON Wed Dec 31 23:00:01 2014",
+		},
+		{
+			header: map[string][]string{
+				"From": {"Herp Derp <herp.derp@example.com>"},
+				"Received": {
+					"from mx.example.com by example.com; Fri, 02 Jan 2015 00:00:01 -0500",
+					"from herp by mx.example.com; Thu, 01 Jan 2015 00:00:01 +0000",
+				},
+				"Date": {"Thu, 01 Jan 2015 00:00:01 +0100"},
+			},
+			line: "From herp.derp@example.com Fri Jan  2 05:00:01 2015",
+		},
+	}
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		w := NewWriter(b)
+		w.SetClock(func() time.Time { return now })
+		if _, err := w.WriteMessage(&mail.Message{Header: test.header, Body: strings.NewReader("Test.\n")}); err != nil {
+			t.Fatal(err)
+		}
+		line := b.String()[:strings.Index(b.String(), "\r\n")]
+		if line != test.line {
+			t.Errorf("Expected From_ line %q, got %q", test.line, line)
+		}
+		if env, err := ParseEnvelope(line); err != nil || !isFromLine([]byte(line)) {
+			t.Errorf("From_ line %q cannot be parsed: %v", line, err)
+		} else if env.Date.IsZero() {
+			t.Errorf("From_ line %q lacks a date", line)
+		}
+	}
+}
+
+func TestWriterIncompleteEnvelope(t *testing.T) {
+	now := time.Date(2015, 1, 3, 0, 0, 1, 0, time.UTC)
+	unparsed, _ := ParseEnvelope("From herp.derp@example.com  yesterday")
+	envelopes := []*Envelope{
+		{},
+		{Sender: "bernd.lauert@example.com"},
+		unparsed,
+	}
+	expected := []string{
+		"From herp.derp@example.com Thu Jan  1 00:00:01 2015",
+		"From bernd.lauert@example.com Thu Jan  1 00:00:01 2015",
+		"From herp.derp@example.com yesterday Thu Jan  1 00:00:01 2015",
+	}
+	raw := "From: Herp Derp <herp.derp@example.com>\r\nDate: Thu, 01 Jan 2015 00:00:01 +0000\r\n\r\nTest.\r\n"
+
+	for _, writeRaw := range []bool{false, true} {
+		b := &bytes.Buffer{}
+		w := NewWriter(b)
+		w.SetClock(func() time.Time { return now })
+		for _, env := range envelopes {
+			var err error
+			if writeRaw {
+				_, err = w.WriteRaw([]byte(raw), env)
+			} else {
+				msg, _ := mail.ReadMessage(strings.NewReader(raw))
+				_, err = w.WriteMessageEnvelope(msg, env)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var got []string
+		m := NewScanner(b, false)
+		for m.Next() {
+			got = append(got, m.Envelope().Raw)
+		}
+		if m.Err() != nil {
+			t.Fatal(m.Err())
+		}
+		if strings.Join(got, "|") != strings.Join(expected, "|") {
+			t.Errorf("WriteRaw %v: Expected From_ lines %q, got %q", writeRaw, expected, got)
+		}
+	}
+}
+
+func TestWriterEnvelopeRoundTrip(t *testing.T) {
+	for _, line := range []string{
+		"From derp.herp@example.com Fri Jan  2 00:00:01 2015 remote from example",
+		"From derp.herp@example.com Fri Jan  2 00:00:01 2015 -0700",
+		"From derp.herp@example.com Fri Jan  2 00:00:01 2015 PST",
+		"From derp.herp@example.com Fri, 2 Jan 2015 00:00:01 -0700",
+		"From derp.herp@example.com yesterday",
+	} {
+		env, _ := ParseEnvelope(line)
+		b := &bytes.Buffer{}
+		w := NewWriter(b)
+		m := &mail.Message{
+			Header: map[string][]string{"From": {"herp.derp@example.com"}, "Subject": {"Test"}},
+			Body:   strings.NewReader("Test.\n"),
+		}
+		if _, err := w.WriteMessageEnvelope(m, env); err != nil {
+			t.Fatal(err)
+		}
+		s := NewScanner(b, false)
+		n := 0
+		for ; s.Next(); n++ {
+			if s.Envelope().Sender != env.Sender {
+				t.Errorf("%q: Expected sender %q, got %q", line, env.Sender, s.Envelope().Sender)
+			}
+		}
+		if s.Err() != nil || n != 1 {
+			t.Errorf("%q: Expected 1 message, got %d and error %v", line, n, s.Err())
+		}
+	}
+}
+
+func TestWriteVerbatimRoundTrip(t *testing.T) {
+	// a body with an unescaped From_ line and a last line without a line
+	// ending
+	unescaped := "From herp.derp@example.com  Thu Jan  1 00:00:01 2015\nFrom: herp.derp@example.com\nSubject: 1\n\n" +
+		"From nobody  Thu Jan  1 00:00:01 2015\nnot a header\n\n" +
+		"From derp.herp@example.com  Thu Jan  2 00:00:01 2015\nFrom: derp.herp@example.com\nSubject: 2\n\nBye."
+	tests := []struct {
+		variant Variant
+		mbox    string
+	}{
+		{Mboxo, unescaped},
+		{Mboxo, strings.Replace(mboxWithThreeMessages+"\n", "\n", "\r\n", -1)},
+		{Mboxrd, mboxrdWithEscapedFroms},
+		{Mboxcl2, mboxclMessages(len(mboxclFirstBody), len(mboxclSecondBody))},
+		{MMDF, mmdfDelimiter + "\nFrom: herp.derp@example.com\n\nHello.\n" + mmdfDelimiter + "\n"},
+	}
+	for _, test := range tests {
+		m := NewScanner(strings.NewReader(test.mbox), false)
+		m.SetVariant(test.variant)
+		b := &bytes.Buffer{}
+		w := NewWriter(b)
+		w.SetVariant(test.variant)
+		for m.Next() {
+			if _, err := w.WriteVerbatim(m.Raw()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if m.Err() != nil {
+			t.Fatal(m.Err())
+		}
+		if b.String() != test.mbox {
+			t.Errorf("%v: mbox changed:\n%q\nexpected:\n%q", test.variant, b.String(), test.mbox)
+		}
+	}
+
+	// the next message starts on a line of its own
+	b := &bytes.Buffer{}
+	w := NewWriter(b)
+	w.SetLineEnding(LF)
+	if _, err := w.WriteVerbatim([]byte("From herp.derp@example.com  Thu Jan  1 00:00:01 2015\nFrom: herp.derp@example.com\nSubject: 1\n\nBye.")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteMessage(&mail.Message{Header: mail.Header{"From": {"derp.herp@example.com"}, "Subject": {"2"}}, Body: strings.NewReader("Hello.\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(subjects(t, b)); n != 2 {
+		t.Errorf("Expected 2 messages, got %d", n)
+	}
+	if _, err := w.WriteVerbatim([]byte("not a From_ line\n")); err != ErrInvalidMboxFormat {
+		t.Errorf("Expected %v, got %v", ErrInvalidMboxFormat, err)
+	}
+}